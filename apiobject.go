@@ -21,6 +21,14 @@ type ApiObject interface {
 	GetObject() runtime.Object
 	// ReplaceObject replaces the underlying Kubernetes object.
 	ReplaceObject(v runtime.Object)
+	// JSONPatch applies an RFC 6902 JSON patch (in JSON or YAML) to the object.
+	JSONPatch(patch []byte) error
+	// MergePatch applies an RFC 7386 JSON merge patch (in JSON or YAML) to the object.
+	MergePatch(patch []byte) error
+	// StrategicMergePatch applies a strategic merge patch (in JSON or YAML) to the object, using the merge keys of the object's Go type in the builder's scheme.
+	// Kinds that are not registered in the scheme (e.g. custom resources) have no merge keys, so they are patched with a JSON merge patch instead,
+	// like kustomize does (the API server rejects strategic merge patches of custom resources).
+	StrategicMergePatch(patch []byte) error
 }
 
 type apiObjectProps struct {
@@ -30,6 +38,8 @@ type apiObjectProps struct {
 type apiObject struct {
 	apiObjectProps
 	globalContext *globalContext
+	// namespaceDefaulted is true if the namespace was set from the scope's namespace.
+	namespaceDefaulted bool
 }
 
 var _ ApiObject = &apiObject{}
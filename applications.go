@@ -0,0 +1,296 @@
+package kgen
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+type applicationType string
+
+const (
+	// An Argo CD Application (argoproj.io/v1alpha1) is generated for each top-level scope.
+	ApplicationTypeArgoCD applicationType = "argocd"
+	// A Flux Kustomization (kustomize.toolkit.fluxcd.io/v1) is generated for each top-level scope, along with a single GitRepository source.
+	// Kustomizations sync whole directories, so the files of each top-level scope must be in a directory of their own
+	// (e.g. with YamlOutputTypeFolderPerScopeFilePerResource); rendering panics otherwise.
+	// The shared files (including the PreInstall file) are moved into a directory named after SharedName, and the other Kustomizations depend on the
+	// shared one when there is a PreInstall file.
+	ApplicationTypeFlux applicationType = "flux"
+)
+
+// ApplicationsOptions configures the generation of GitOps application objects (app-of-apps layout) pointing at the rendered manifests.
+// The applications are named after the top-level scopes, converted to valid object names (lowercase, with invalid characters replaced by '-').
+type ApplicationsOptions struct {
+	// Type is the kind of application objects to generate. Default is ApplicationTypeArgoCD.
+	Type applicationType
+	// RepoURL is the URL of the git repository the rendered manifests are committed to.
+	RepoURL string
+	// TargetRevision is the git revision (branch, tag or commit for Argo CD, branch for Flux) to sync from.
+	// If empty, it is left out and the default of each tool applies: HEAD for Argo CD, the master branch for Flux.
+	TargetRevision string
+	// Path is the path of RenderManifestsOptions.Outdir relative to the root of the git repository.
+	Path string
+	// Filename is the file (relative to Outdir, without extension) the application objects are written to. Default is "applications".
+	// Point your app-of-apps at this file.
+	Filename string
+	// Namespace is the namespace of the generated application objects. Default is "argocd" for Argo CD and "flux-system" for Flux.
+	Namespace string
+	// SharedName is the name of the application generated for files that don't belong to a single top-level scope
+	// (objects added directly to the builder, files mixing objects from multiple scopes, and the PreInstall file). Default is "shared".
+	SharedName string
+	// Prune enables automated sync with pruning (and self-heal for Argo CD).
+	Prune bool
+	// Project is the Argo CD project of the applications. Default is "default".
+	Project string
+	// DestinationServer is the Argo CD destination cluster. Default is "https://kubernetes.default.svc".
+	DestinationServer string
+	// SourceName is the name of the generated Flux GitRepository. Default is "kgen".
+	SourceName string
+	// Interval is the Flux reconciliation interval. Default is "10m".
+	Interval string
+}
+
+type applicationSource struct {
+	name      string
+	namespace string
+	files     []string
+	shared    bool
+}
+
+var invalidObjectNameChars = regexp.MustCompile(`[^a-z0-9.-]+`)
+
+// objectName converts a scope ID to a valid object name (a DNS-1123 subdomain), e.g. "my-app" for "My_App".
+func objectName(id string) string {
+	name := invalidObjectNameChars.ReplaceAllString(strings.ToLower(id), "-")
+	if len(name) > validation.DNS1123SubdomainMaxLength {
+		name = name[:validation.DNS1123SubdomainMaxLength]
+	}
+	return strings.Trim(name, "-.")
+}
+
+// constructApplicationSources groups the rendered files by the top-level scope their objects belong to. The pre-install file is always shared.
+func constructApplicationSources(files map[string][]ApiObject, root *scope, sharedName string, preInstallFile string) []applicationSource {
+	owners := map[ApiObject]*scope{}
+	for _, child := range root.children {
+		_ = child.WalkApiObjects(func(apiObject ApiObject) error {
+			owners[apiObject] = child
+			return nil
+		})
+	}
+	scopeFiles := map[*scope][]string{}
+	sharedFiles := []string{}
+	for filePath, apiObjects := range files {
+		var owner *scope
+		for i, apiObject := range apiObjects {
+			if i == 0 {
+				owner = owners[apiObject]
+			} else if owner != owners[apiObject] {
+				owner = nil
+			}
+		}
+		if owner == nil || filePath == preInstallFile {
+			sharedFiles = append(sharedFiles, filePath)
+		} else {
+			scopeFiles[owner] = append(scopeFiles[owner], filePath)
+		}
+	}
+	sources := []applicationSource{}
+	for _, child := range root.children {
+		if len(scopeFiles[child]) == 0 {
+			continue
+		}
+		namespace, _ := child.GetContext(namespaceContextKey).(string)
+		sources = append(sources, applicationSource{name: child.ID(), namespace: namespace, files: scopeFiles[child]})
+	}
+	if len(sharedFiles) > 0 {
+		sources = append(sources, applicationSource{name: sharedName, files: sharedFiles, shared: true})
+	}
+	for _, source := range sources {
+		slices.Sort(source.files)
+	}
+	return sources
+}
+
+// sourceDir returns the deepest directory containing all the files of the source, and whether that directory contains no other rendered files.
+func (s applicationSource) sourceDir(files map[string][]ApiObject) (string, bool) {
+	dir := path.Dir(s.files[0])
+	for _, filePath := range s.files[1:] {
+		for dir != "." && !strings.HasPrefix(filePath, dir+"/") {
+			dir = path.Dir(dir)
+		}
+	}
+	if dir == "." {
+		return dir, false
+	}
+	for filePath := range files {
+		if strings.HasPrefix(filePath, dir+"/") && !slices.Contains(s.files, filePath) {
+			return dir, false
+		}
+	}
+	return dir, true
+}
+
+// moveSharedFiles moves the files of the shared source into a directory named after it, so that they can be synced by a Flux Kustomization.
+func (a *builder) moveSharedFiles(files map[string][]ApiObject, source applicationSource) {
+	for i, filePath := range source.files {
+		newPath := path.Join(source.name, filePath)
+		if _, ok := files[newPath]; ok {
+			a.Logger().Panicf("Applications: can't move shared file '%s' to '%s', which already contains rendered objects; set SharedName to an unused directory", filePath, newPath)
+		}
+		files[newPath] = files[filePath]
+		delete(files, filePath)
+		source.files[i] = newPath
+	}
+}
+
+func (a *builder) constructApplications(files map[string][]ApiObject, opts ApplicationsOptions, preInstallFile string) []ApiObject {
+	if opts.Type == "" {
+		opts.Type = ApplicationTypeArgoCD
+	}
+	if opts.RepoURL == "" {
+		a.Logger().Panicf("Applications: RepoURL is required")
+	}
+	if opts.SharedName == "" {
+		opts.SharedName = "shared"
+	}
+	if opts.Project == "" {
+		opts.Project = "default"
+	}
+	if opts.DestinationServer == "" {
+		opts.DestinationServer = "https://kubernetes.default.svc"
+	}
+	if opts.SourceName == "" {
+		opts.SourceName = "kgen"
+	}
+	if opts.Interval == "" {
+		opts.Interval = "10m"
+	}
+	if opts.Namespace == "" {
+		switch opts.Type {
+		case ApplicationTypeArgoCD:
+			opts.Namespace = "argocd"
+		case ApplicationTypeFlux:
+			opts.Namespace = "flux-system"
+		}
+	}
+
+	objects := []map[string]any{}
+	if opts.Type == ApplicationTypeFlux {
+		spec := map[string]any{"interval": opts.Interval, "url": opts.RepoURL}
+		if opts.TargetRevision != "" {
+			spec["ref"] = map[string]any{"branch": opts.TargetRevision}
+		}
+		objects = append(objects, map[string]any{
+			"apiVersion": "source.toolkit.fluxcd.io/v1",
+			"kind":       "GitRepository",
+			"metadata":   map[string]any{"name": opts.SourceName, "namespace": opts.Namespace},
+			"spec":       spec,
+		})
+	}
+	sources := constructApplicationSources(files, a.Scope.(*scope), opts.SharedName, preInstallFile)
+	names := map[string]string{}
+	sharedName := ""
+	for _, source := range sources {
+		name := objectName(source.name)
+		if name == "" {
+			a.Logger().Panicf("Applications: scope '%s' has no valid characters for an application name", source.name)
+		}
+		if other, ok := names[name]; ok {
+			a.Logger().Panicf("Applications: scopes '%s' and '%s' have the same application name '%s'", other, source.name, name)
+		}
+		names[name] = source.name
+		if source.shared {
+			sharedName = name
+			if _, exclusive := source.sourceDir(files); opts.Type == ApplicationTypeFlux && !exclusive {
+				a.moveSharedFiles(files, source)
+			}
+		}
+	}
+	for _, source := range sources {
+		name := objectName(source.name)
+		dir, exclusive := source.sourceDir(files)
+		switch opts.Type {
+		case ApplicationTypeArgoCD:
+			directory := map[string]any{}
+			if !exclusive {
+				include := []string{}
+				for _, filePath := range source.files {
+					include = append(include, strings.TrimPrefix(filePath, dir+"/")+".yaml")
+				}
+				if len(include) == 1 {
+					directory["include"] = include[0]
+				} else {
+					directory["include"] = fmt.Sprintf("{%s}", strings.Join(include, ","))
+				}
+			}
+			for _, filePath := range source.files {
+				if path.Dir(filePath) != dir {
+					directory["recurse"] = true
+				}
+			}
+			argoSource := map[string]any{
+				"repoURL":   opts.RepoURL,
+				"path":      path.Join(opts.Path, dir),
+				"directory": directory,
+			}
+			if opts.TargetRevision != "" {
+				argoSource["targetRevision"] = opts.TargetRevision
+			}
+			spec := map[string]any{
+				"project":     opts.Project,
+				"source":      argoSource,
+				"destination": map[string]any{"server": opts.DestinationServer},
+			}
+			if source.namespace != "" {
+				spec["destination"].(map[string]any)["namespace"] = source.namespace
+			}
+			if opts.Prune {
+				spec["syncPolicy"] = map[string]any{"automated": map[string]any{"prune": true, "selfHeal": true}}
+			}
+			objects = append(objects, map[string]any{
+				"apiVersion": "argoproj.io/v1alpha1",
+				"kind":       "Application",
+				"metadata":   map[string]any{"name": name, "namespace": opts.Namespace},
+				"spec":       spec,
+			})
+		case ApplicationTypeFlux:
+			if !exclusive {
+				a.Logger().Panicf("Applications: files of '%s' are not in a directory of their own, which Flux Kustomizations require (see YamlOutputTypeFolderPerScopeFilePerResource)", source.name)
+			}
+			spec := map[string]any{
+				"interval":  opts.Interval,
+				"path":      "./" + path.Join(opts.Path, dir),
+				"prune":     opts.Prune,
+				"sourceRef": map[string]any{"kind": "GitRepository", "name": opts.SourceName},
+			}
+			if preInstallFile != "" && !source.shared {
+				// the pre-install objects (e.g. CRDs) are in the shared Kustomization
+				spec["dependsOn"] = []any{map[string]any{"name": sharedName}}
+			}
+			objects = append(objects, map[string]any{
+				"apiVersion": "kustomize.toolkit.fluxcd.io/v1",
+				"kind":       "Kustomization",
+				"metadata":   map[string]any{"name": name, "namespace": opts.Namespace},
+				"spec":       spec,
+			})
+		default:
+			a.Logger().Panicf("Applications: unknown type '%s'", opts.Type)
+		}
+	}
+
+	globalContext := a.Scope.(*scope).globalContext
+	apiObjects := []ApiObject{}
+	for _, object := range objects {
+		apiObjects = append(apiObjects, &apiObject{
+			apiObjectProps: apiObjectProps{Unstructured: &unstructured.Unstructured{Object: object}},
+			globalContext:  globalContext,
+		})
+	}
+	return apiObjects
+}
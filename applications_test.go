@@ -0,0 +1,146 @@
+package kgen
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/yaml"
+)
+
+func readRenderedObjects(t *testing.T, filePath string) []map[string]any {
+	t.Helper()
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	objects := []map[string]any{}
+	for _, document := range strings.Split(string(data), "---\n") {
+		object := map[string]any{}
+		if err := yaml.Unmarshal([]byte(document), &object); err != nil {
+			t.Fatal(err)
+		}
+		objects = append(objects, object)
+	}
+	return objects
+}
+
+func newTestApplicationsTree() Builder {
+	builder := NewBuilder(BuilderOptions{SchemeBuilder: runtime.SchemeBuilder{corev1.AddToScheme}})
+	app := builder.CreateScope("My_App", ScopeProps{Namespace: "app"})
+	addTestConfigMap(app, "config")
+	app.AddApiObjectFromMap(map[string]any{
+		"apiVersion": "apiextensions.k8s.io/v1",
+		"kind":       "CustomResourceDefinition",
+		"metadata":   map[string]any{"name": "widgets.example.com"},
+		"spec":       map[string]any{"group": "example.com", "scope": "Namespaced", "names": map[string]any{"kind": "Widget"}},
+	})
+	addTestConfigMap(builder.CreateScope("db", ScopeProps{Namespace: "db"}), "db-config")
+	return builder
+}
+
+func TestFluxApplicationsWithPreInstall(t *testing.T) {
+	outdir := t.TempDir()
+	newTestApplicationsTree().RenderManifests(RenderManifestsOptions{
+		Outdir:         outdir,
+		YamlOutputType: YamlOutputTypeFolderPerScopeFilePerResource,
+		PreInstall:     &PreInstallOptions{},
+		Applications:   &ApplicationsOptions{Type: ApplicationTypeFlux, RepoURL: "https://example.com/repo.git", Path: "manifests"},
+	})
+	// the pre-install file is moved into the directory of the shared Kustomization
+	if objects := readRenderedObjects(t, filepath.Join(outdir, "shared", "00-crds.yaml")); len(objects) != 1 || objects[0]["kind"] != "CustomResourceDefinition" {
+		t.Errorf("shared/00-crds.yaml = %v, want the CustomResourceDefinition", objects)
+	}
+	kustomizations := map[string]map[string]any{}
+	for _, object := range readRenderedObjects(t, filepath.Join(outdir, "applications.yaml")) {
+		if object["kind"] == "Kustomization" {
+			kustomizations[object["metadata"].(map[string]any)["name"].(string)] = object["spec"].(map[string]any)
+		}
+	}
+	if names := slices.Sorted(maps.Keys(kustomizations)); !slices.Equal(names, []string{"db", "my-app", "shared"}) {
+		t.Fatalf("kustomizations = %v, want [db my-app shared]", names)
+	}
+	for name, wantPath := range map[string]string{"my-app": "./manifests/My_App", "db": "./manifests/db", "shared": "./manifests/shared"} {
+		if path := kustomizations[name]["path"]; path != wantPath {
+			t.Errorf("path of '%s' = %v, want %s", name, path, wantPath)
+		}
+	}
+	if dependsOn := kustomizations["my-app"]["dependsOn"]; !reflect.DeepEqual(dependsOn, []any{map[string]any{"name": "shared"}}) {
+		t.Errorf("dependsOn of 'my-app' = %v, want the shared Kustomization", dependsOn)
+	}
+	if _, ok := kustomizations["shared"]["dependsOn"]; ok {
+		t.Error("the shared Kustomization must not depend on itself")
+	}
+}
+
+func TestArgoCDApplicationNames(t *testing.T) {
+	outdir := t.TempDir()
+	newTestApplicationsTree().RenderManifests(RenderManifestsOptions{
+		Outdir:         outdir,
+		YamlOutputType: YamlOutputTypeFilePerScope,
+		Applications:   &ApplicationsOptions{RepoURL: "https://example.com/repo.git"},
+	})
+	names := []string{}
+	for _, object := range readRenderedObjects(t, filepath.Join(outdir, "applications.yaml")) {
+		names = append(names, object["metadata"].(map[string]any)["name"].(string))
+	}
+	if want := []string{"my-app", "db"}; !slices.Equal(names, want) {
+		t.Errorf("applications = %v, want %v", names, want)
+	}
+}
+
+func TestObjectName(t *testing.T) {
+	for id, want := range map[string]string{
+		"app":                    "app",
+		"My_App":                 "my-app",
+		"-team/app.v2-":          "team-app.v2",
+		strings.Repeat("a", 300): strings.Repeat("a", 253),
+	} {
+		if got := objectName(id); got != want {
+			t.Errorf("objectName(%q) = %q, want %q", id, got, want)
+		}
+	}
+}
+
+func TestApplicationsTargetRevision(t *testing.T) {
+	for _, targetRevision := range []string{"", "v1.2.0"} {
+		t.Run("revision "+targetRevision, func(t *testing.T) {
+			outdir := t.TempDir()
+			newTestApplicationsTree().RenderManifests(RenderManifestsOptions{
+				Outdir:         outdir,
+				YamlOutputType: YamlOutputTypeFolderPerScopeFilePerResource,
+				Applications:   &ApplicationsOptions{RepoURL: "https://example.com/repo.git", TargetRevision: targetRevision},
+			})
+			for _, object := range readRenderedObjects(t, filepath.Join(outdir, "applications.yaml")) {
+				revision, ok := object["spec"].(map[string]any)["source"].(map[string]any)["targetRevision"]
+				// an unset revision is left out for Argo CD to use HEAD
+				if (targetRevision == "" && ok) || (targetRevision != "" && revision != targetRevision) {
+					t.Errorf("targetRevision = %v, want %q", revision, targetRevision)
+				}
+			}
+
+			outdir = t.TempDir()
+			newTestApplicationsTree().RenderManifests(RenderManifestsOptions{
+				Outdir:         outdir,
+				YamlOutputType: YamlOutputTypeFolderPerScopeFilePerResource,
+				Applications:   &ApplicationsOptions{Type: ApplicationTypeFlux, RepoURL: "https://example.com/repo.git", TargetRevision: targetRevision},
+			})
+			for _, object := range readRenderedObjects(t, filepath.Join(outdir, "applications.yaml")) {
+				if object["kind"] != "GitRepository" {
+					continue
+				}
+				ref, ok := object["spec"].(map[string]any)["ref"]
+				// an unset revision is left out for Flux to use the master branch
+				if (targetRevision == "" && ok) || (targetRevision != "" && !reflect.DeepEqual(ref, map[string]any{"branch": targetRevision})) {
+					t.Errorf("ref = %v, want the branch %q", ref, targetRevision)
+				}
+			}
+		})
+	}
+}
@@ -2,13 +2,16 @@ package kgen
 
 import (
 	"fmt"
+	"maps"
 	"os"
 	"path"
+	"slices"
 	"strings"
 
 	"github.com/blesswinsamuel/kgen/internal"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 )
 
@@ -26,19 +29,36 @@ const (
 	YamlOutputTypeFolderPerScopeFilePerResource yamlOutputType = "folder"
 	// Resources are split into seperate files by scope, while creating a folder for each scope.
 	YamlOutputTypeFolderPerScopeFilePerLeafScope yamlOutputType = "folder-per-parent"
+	// Each resource is output to its own file in a folder named after its namespace. Cluster-scoped resources go into the "_cluster" folder.
+	// Rendering panics if resources of different scopes have the same kind, namespace and name.
+	YamlOutputTypeFolderPerNamespace yamlOutputType = "namespace"
+	// Each resource is output to its own file in a folder named after the category of its kind (crds, rbac, workloads, ...).
+	// Rendering panics if resources of different scopes have the same kind, namespace and name.
+	YamlOutputTypeFolderPerKind yamlOutputType = "kind"
 )
 
 type RenderManifestsOptions struct {
 	// The directory to write the YAML files to. If set to "-", the YAML files will be written to stdout.
 	Outdir string
-	// The output format for the YAML files.
+	// The output format for the YAML files. Scopes can override it for their subtree with ScopeProps.YamlOutputType.
 	YamlOutputType yamlOutputType
 	// Include a number in the filenames to maintain order.
 	IncludeNumberInFilenames bool
 	// Delete the output directory before writing the YAML files.
 	DeleteOutDir bool
+	// GenerateNamespaces, if set, generates a Namespace object for every namespace used by the objects in the tree, unless one was added explicitly.
+	// To generate Namespaces for specific scopes only, see ScopeProps.CreateNamespace.
+	GenerateNamespaces *NamespaceProps
 	// PatchObject is a function that can be used to modify the ApiObjects before they are rendered.
 	PatchObject func(ApiObject) error
+	// Filename, if set, returns the path (relative to Outdir) of the file each object is written to. Objects with the same path are written to the same file.
+	// It takes precedence over YamlOutputType, except in scopes overriding it with ScopeProps.YamlOutputType. See FilenameTemplate for a template based alternative.
+	// The path must be relative and stay within Outdir, otherwise rendering panics.
+	Filename func(FilenameInfo) string
+	// PreInstall, if set, moves CustomResourceDefinitions, Namespaces and other configured kinds into a separate file, regardless of the scope that added them.
+	PreInstall *PreInstallOptions
+	// Applications, if set, generates an Argo CD Application or Flux Kustomization for each top-level scope, pointing at the files the scope is rendered to.
+	Applications *ApplicationsOptions
 }
 
 // Builder is the main interface for adding Kubernetes API objects and rendering them to YAML files.
@@ -53,6 +73,9 @@ type BuilderOptions struct {
 	SchemeBuilder runtime.SchemeBuilder
 	// Logger is used to log messages. If not set, a default logger is used.
 	Logger Logger
+	// ClusterScopedKinds are the kinds (usually of custom resources) that don't get the namespace of the scope they are added to.
+	// Built-in Kubernetes kinds and kinds defined by cluster-scoped CustomResourceDefinitions added to the builder are already known.
+	ClusterScopedKinds []schema.GroupKind
 }
 
 type builder struct {
@@ -60,8 +83,10 @@ type builder struct {
 }
 
 type globalContext struct {
-	scheme *runtime.Scheme
-	logger Logger
+	scheme         *runtime.Scheme
+	logger         Logger
+	resourceScopes *resourceScopes
+	renderHooks    []func() error
 }
 
 // NewBuilder creates a new Builder instance.
@@ -76,14 +101,35 @@ func NewBuilder(opts BuilderOptions) Builder {
 		opts.Logger = NewCustomLogger(nil)
 	}
 	scope := newScope("__root__", ScopeProps{}, &globalContext{
-		scheme: scheme,
-		logger: opts.Logger,
+		scheme:         scheme,
+		logger:         opts.Logger,
+		resourceScopes: newResourceScopes(opts.ClusterScopedKinds),
 	})
 	return &builder{
 		Scope: scope,
 	}
 }
 
+// NewBuilderFrom creates a new, empty Builder with the scheme, logger and cluster-scoped kinds of the builder of the given scope,
+// e.g. to run code that adds objects without adding them to that builder.
+func NewBuilderFrom(s Scope) Builder {
+	if b, ok := s.(*builder); ok {
+		s = b.Scope
+	}
+	sc, ok := s.(*scope)
+	if !ok {
+		panic(fmt.Sprintf("unsupported Scope implementation %T", s))
+	}
+	resourceScopes := &resourceScopes{clusterScoped: maps.Clone(sc.globalContext.resourceScopes.clusterScoped)}
+	return &builder{
+		Scope: newScope("__root__", ScopeProps{}, &globalContext{
+			scheme:         sc.globalContext.scheme,
+			logger:         sc.globalContext.logger,
+			resourceScopes: resourceScopes,
+		}),
+	}
+}
+
 func getObjectNameAndNamespace(apiObject ApiObject) string {
 	obj := apiObject.GetObject().(*unstructured.Unstructured)
 	out := []string{}
@@ -95,20 +141,104 @@ func getObjectNameAndNamespace(apiObject ApiObject) string {
 	return strings.Join(out, "-")
 }
 
-func constructFilenameToApiObjectsMap(files map[string][]ApiObject, scope *scope, currentScopeID []string, level int, opts RenderManifestsOptions) {
+var kindFolders = map[schema.GroupKind]string{
+	{Group: "apiextensions.k8s.io", Kind: "CustomResourceDefinition"}:                 "crds",
+	{Group: "", Kind: "Namespace"}:                                                    "namespaces",
+	{Group: "", Kind: "ServiceAccount"}:                                               "rbac",
+	{Group: "rbac.authorization.k8s.io", Kind: "Role"}:                                "rbac",
+	{Group: "rbac.authorization.k8s.io", Kind: "ClusterRole"}:                         "rbac",
+	{Group: "rbac.authorization.k8s.io", Kind: "RoleBinding"}:                         "rbac",
+	{Group: "rbac.authorization.k8s.io", Kind: "ClusterRoleBinding"}:                  "rbac",
+	{Group: "", Kind: "Pod"}:                                                          "workloads",
+	{Group: "apps", Kind: "Deployment"}:                                               "workloads",
+	{Group: "apps", Kind: "StatefulSet"}:                                              "workloads",
+	{Group: "apps", Kind: "DaemonSet"}:                                                "workloads",
+	{Group: "apps", Kind: "ReplicaSet"}:                                               "workloads",
+	{Group: "batch", Kind: "Job"}:                                                     "workloads",
+	{Group: "batch", Kind: "CronJob"}:                                                 "workloads",
+	{Group: "autoscaling", Kind: "HorizontalPodAutoscaler"}:                           "workloads",
+	{Group: "policy", Kind: "PodDisruptionBudget"}:                                    "workloads",
+	{Group: "", Kind: "Service"}:                                                      "networking",
+	{Group: "", Kind: "Endpoints"}:                                                    "networking",
+	{Group: "discovery.k8s.io", Kind: "EndpointSlice"}:                                "networking",
+	{Group: "networking.k8s.io", Kind: "Ingress"}:                                     "networking",
+	{Group: "extensions", Kind: "Ingress"}:                                            "networking",
+	{Group: "networking.k8s.io", Kind: "IngressClass"}:                                "networking",
+	{Group: "networking.k8s.io", Kind: "NetworkPolicy"}:                               "networking",
+	{Group: "", Kind: "ConfigMap"}:                                                    "config",
+	{Group: "", Kind: "Secret"}:                                                       "config",
+	{Group: "", Kind: "PersistentVolume"}:                                             "storage",
+	{Group: "", Kind: "PersistentVolumeClaim"}:                                        "storage",
+	{Group: "storage.k8s.io", Kind: "StorageClass"}:                                   "storage",
+	{Group: "", Kind: "LimitRange"}:                                                   "policy",
+	{Group: "", Kind: "ResourceQuota"}:                                                "policy",
+	{Group: "scheduling.k8s.io", Kind: "PriorityClass"}:                               "policy",
+	{Group: "admissionregistration.k8s.io", Kind: "MutatingWebhookConfiguration"}:     "admission",
+	{Group: "admissionregistration.k8s.io", Kind: "ValidatingWebhookConfiguration"}:   "admission",
+	{Group: "admissionregistration.k8s.io", Kind: "ValidatingAdmissionPolicy"}:        "admission",
+	{Group: "admissionregistration.k8s.io", Kind: "ValidatingAdmissionPolicyBinding"}: "admission",
+}
+
+// getKindFolder returns the folder used by YamlOutputTypeFolderPerKind for the object. Custom resources go into the "other" folder.
+func getKindFolder(apiObject ApiObject) string {
+	groupKind := apiObject.GetObject().GetObjectKind().GroupVersionKind().GroupKind()
+	if folder, ok := kindFolders[groupKind]; ok {
+		return folder
+	}
+	return "other"
+}
+
+// addFileInFolder adds the object to its own file in a folder shared by the objects of all the scopes (YamlOutputTypeFolderPerNamespace and YamlOutputTypeFolderPerKind).
+// The files are numbered in the order of the objects in the folder if includeNumber is set. It panics if another object has the same filename.
+func (s *scope) addFileInFolder(files map[string][]ApiObject, folder string, name string, apiObject ApiObject, includeNumber bool) {
+	number := 1
+	for filePath := range files {
+		if path.Dir(filePath) != folder {
+			continue
+		}
+		number++
+		otherName := path.Base(filePath)
+		if includeNumber {
+			_, otherName, _ = strings.Cut(otherName, "-")
+		}
+		if otherName == name {
+			s.Logger().Panicf("%s '%s' of scope '%s' has the same filename '%s' as another object in '%s'", apiObject.GetKind(), apiObject.GetName(), strings.Join(s.Path(), "/"), name, folder)
+		}
+	}
+	if includeNumber {
+		name = fmt.Sprintf("%02d-%s", number, name)
+	}
+	files[path.Join(folder, name)] = []ApiObject{apiObject}
+}
+
+func constructFilenameToApiObjectsMap(files map[string][]ApiObject, scope *scope, currentScopeID []string, outputScopeID []string, level int, opts RenderManifestsOptions) {
 	if scope == nil {
 		return
 	}
+	if outputType, ok := scope.context[yamlOutputTypeContextKey].(yamlOutputType); ok {
+		// the scope overrides the output type for its subtree
+		opts.YamlOutputType = outputType
+		opts.Filename = nil
+		outputScopeID = slices.Clone(currentScopeID)
+	}
 	sprintfWithNumber := func(n int, s string) string {
 		if opts.IncludeNumberInFilenames {
 			return fmt.Sprintf("%02d-%s", n, s)
 		}
 		return s
 	}
-	if len(scope.objects) > 0 {
+	if len(scope.objects) > 0 && opts.Filename != nil {
+		for i, apiObject := range scope.objects {
+			filePath := scope.customFilename(i, apiObject, opts.Filename)
+			files[filePath] = append(files[filePath], apiObject)
+		}
+	} else if len(scope.objects) > 0 {
 		switch opts.YamlOutputType {
 		case YamlOutputTypeSingleFile:
 			filePath := "all"
+			if len(outputScopeID) > 0 {
+				filePath = strings.Join(outputScopeID, "-")
+			}
 			files[filePath] = append(files[filePath], scope.objects...)
 		case YamlOutputTypeFilePerResource:
 			for i, apiObject := range scope.objects {
@@ -133,15 +263,47 @@ func constructFilenameToApiObjectsMap(files map[string][]ApiObject, scope *scope
 				filePath = path.Join(filePath, sprintfWithNumber(0, scope.ID()))
 			}
 			files[filePath] = append(files[filePath], scope.objects...)
+		case YamlOutputTypeFolderPerNamespace:
+			for _, apiObject := range scope.objects {
+				namespace := apiObject.GetNamespace()
+				if namespace == "" {
+					namespace = "_cluster"
+				}
+				scope.addFileInFolder(files, path.Join(path.Join(outputScopeID...), namespace), strings.ToLower(apiObject.GetKind())+"-"+apiObject.GetName(), apiObject, opts.IncludeNumberInFilenames)
+			}
+		case YamlOutputTypeFolderPerKind:
+			for _, apiObject := range scope.objects {
+				scope.addFileInFolder(files, path.Join(path.Join(outputScopeID...), getKindFolder(apiObject)), getObjectNameAndNamespace(apiObject), apiObject, opts.IncludeNumberInFilenames)
+			}
 		}
 	}
 	for i, childScope := range scope.children {
 		thisScopeID := append(currentScopeID, sprintfWithNumber(i+1, childScope.ID()))
-		constructFilenameToApiObjectsMap(files, childScope, thisScopeID, level+1, opts)
+		constructFilenameToApiObjectsMap(files, childScope, thisScopeID, outputScopeID, level+1, opts)
 	}
 }
 
+// Root, Placeholder and OnRenderManifests forward to the root scope, as they are not part of the embedded Scope interface.
+
+func (a *builder) Root() Scope {
+	return a.Scope.(*scope).Root()
+}
+
+func (a *builder) Placeholder() Scope {
+	return a.Scope.(*scope).Placeholder()
+}
+
+func (a *builder) OnRenderManifests(fn func() error) {
+	a.Scope.(*scope).OnRenderManifests(fn)
+}
+
 func (a *builder) RenderManifests(opts RenderManifestsOptions) {
+	for _, hook := range a.Scope.(*scope).globalContext.renderHooks {
+		if err := hook(); err != nil {
+			a.Logger().Panicf("%v", err)
+		}
+	}
+	generateNamespaces(a.Scope.(*scope), opts.GenerateNamespaces)
 	if opts.PatchObject != nil {
 		if err := a.Scope.WalkApiObjects(opts.PatchObject); err != nil {
 			a.Logger().Panicf("PatchObject: %v", err)
@@ -152,7 +314,32 @@ func (a *builder) RenderManifests(opts RenderManifestsOptions) {
 	}
 
 	files := map[string][]ApiObject{} // map[filename]apiObjects
-	constructFilenameToApiObjectsMap(files, a.Scope.(*scope), []string{}, 0, opts)
+	constructFilenameToApiObjectsMap(files, a.Scope.(*scope), []string{}, []string{}, 0, opts)
+	preInstallFile := ""
+	if opts.PreInstall != nil {
+		filePath := opts.PreInstall.Filename
+		if filePath == "" {
+			filePath = "00-crds"
+		}
+		preInstallObjects := extractPreInstallObjects(files, *opts.PreInstall)
+		if _, ok := files[filePath]; ok {
+			a.Logger().Panicf("PreInstall: file '%s' already contains rendered objects", filePath)
+		}
+		if len(preInstallObjects) > 0 {
+			files[filePath] = preInstallObjects
+			preInstallFile = filePath
+		}
+	}
+	if opts.Applications != nil {
+		filePath := opts.Applications.Filename
+		if filePath == "" {
+			filePath = "applications"
+		}
+		if _, ok := files[filePath]; ok {
+			a.Logger().Panicf("Applications: file '%s' already contains rendered objects", filePath)
+		}
+		files[filePath] = a.constructApplications(files, *opts.Applications, preInstallFile)
+	}
 
 	fileContents := map[string][]byte{}
 	for _, currentScopeID := range internal.MapKeysSorted(files) {
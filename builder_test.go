@@ -0,0 +1,179 @@
+package kgen
+
+import (
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/blesswinsamuel/kgen/internal"
+
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// newTestTree builds app (namespace app) with a ConfigMap, and its child scope db with a ConfigMap and a ClusterRole.
+func newTestTree() Builder {
+	builder := NewBuilder(BuilderOptions{SchemeBuilder: runtime.SchemeBuilder{corev1.AddToScheme, rbacv1.AddToScheme}})
+	app := builder.CreateScope("app", ScopeProps{Namespace: "app"})
+	addTestConfigMap(app, "config")
+	db := app.CreateScope("db", ScopeProps{})
+	addTestConfigMap(db, "db-config")
+	db.AddApiObjectFromMap(map[string]any{"apiVersion": "rbac.authorization.k8s.io/v1", "kind": "ClusterRole", "metadata": map[string]any{"name": "reader"}})
+	return builder
+}
+
+func TestConstructFilenameToApiObjectsMap(t *testing.T) {
+	tests := []struct {
+		name string
+		opts RenderManifestsOptions
+		want map[string][]string
+	}{
+		{
+			name: "single file",
+			opts: RenderManifestsOptions{YamlOutputType: YamlOutputTypeSingleFile},
+			want: map[string][]string{"all": {"config", "db-config", "reader"}},
+		},
+		{
+			name: "file per scope",
+			opts: RenderManifestsOptions{YamlOutputType: YamlOutputTypeFilePerScope},
+			want: map[string][]string{"app": {"config"}, "app-db": {"db-config", "reader"}},
+		},
+		{
+			name: "file per scope with numbers",
+			opts: RenderManifestsOptions{YamlOutputType: YamlOutputTypeFilePerScope, IncludeNumberInFilenames: true},
+			want: map[string][]string{"01-app": {"config"}, "01-app-01-db": {"db-config", "reader"}},
+		},
+		{
+			name: "file per resource",
+			opts: RenderManifestsOptions{YamlOutputType: YamlOutputTypeFilePerResource},
+			want: map[string][]string{
+				"app-app-configmap-config":       {"config"},
+				"app-db-app-configmap-db-config": {"db-config"},
+				"app-db-clusterrole-reader":      {"reader"},
+			},
+		},
+		{
+			name: "folder per scope file per resource",
+			opts: RenderManifestsOptions{YamlOutputType: YamlOutputTypeFolderPerScopeFilePerResource},
+			want: map[string][]string{
+				"app/app/app-configmap-config":   {"config"},
+				"app/db/app-configmap-db-config": {"db-config"},
+				"app/db/clusterrole-reader":      {"reader"},
+			},
+		},
+		{
+			name: "folder per scope file per leaf scope",
+			opts: RenderManifestsOptions{YamlOutputType: YamlOutputTypeFolderPerScopeFilePerLeafScope},
+			want: map[string][]string{"app/app": {"config"}, "app/db": {"db-config", "reader"}},
+		},
+		{
+			name: "folder per namespace",
+			opts: RenderManifestsOptions{YamlOutputType: YamlOutputTypeFolderPerNamespace},
+			want: map[string][]string{
+				"app/configmap-config":        {"config"},
+				"app/configmap-db-config":     {"db-config"},
+				"_cluster/clusterrole-reader": {"reader"},
+			},
+		},
+		{
+			name: "folder per kind",
+			opts: RenderManifestsOptions{YamlOutputType: YamlOutputTypeFolderPerKind},
+			want: map[string][]string{
+				"config/app-configmap-config":    {"config"},
+				"config/app-configmap-db-config": {"db-config"},
+				"rbac/clusterrole-reader":        {"reader"},
+			},
+		},
+		{
+			name: "folder per namespace with numbers",
+			opts: RenderManifestsOptions{YamlOutputType: YamlOutputTypeFolderPerNamespace, IncludeNumberInFilenames: true},
+			want: map[string][]string{
+				"app/01-configmap-config":        {"config"},
+				"app/02-configmap-db-config":     {"db-config"},
+				"_cluster/01-clusterrole-reader": {"reader"},
+			},
+		},
+		{
+			name: "folder per kind with numbers",
+			opts: RenderManifestsOptions{YamlOutputType: YamlOutputTypeFolderPerKind, IncludeNumberInFilenames: true},
+			want: map[string][]string{
+				"config/01-app-configmap-config":    {"config"},
+				"config/02-app-configmap-db-config": {"db-config"},
+				"rbac/01-clusterrole-reader":        {"reader"},
+			},
+		},
+		{
+			name: "custom filename",
+			opts: RenderManifestsOptions{Filename: func(info FilenameInfo) string {
+				return strings.Join(info.ScopePath, "/") + "/" + strings.ToLower(info.Kind)
+			}},
+			want: map[string][]string{"app/configmap": {"config"}, "app/db/configmap": {"db-config"}, "app/db/clusterrole": {"reader"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := map[string][]ApiObject{}
+			constructFilenameToApiObjectsMap(files, newTestTree().(*builder).Scope.(*scope), []string{}, []string{}, 0, tt.opts)
+			got := map[string][]string{}
+			for filePath, objects := range files {
+				for _, object := range objects {
+					got[filePath] = append(got[filePath], object.GetName())
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("files = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConstructFilenameToApiObjectsMapScopeOutputType(t *testing.T) {
+	b := newTestTree()
+	other := b.CreateScope("other", ScopeProps{Namespace: "other", YamlOutputType: YamlOutputTypeSingleFile})
+	addTestConfigMap(other.CreateScope("a", ScopeProps{}), "a")
+	addTestConfigMap(other.CreateScope("b", ScopeProps{}), "b")
+	files := map[string][]ApiObject{}
+	constructFilenameToApiObjectsMap(files, b.(*builder).Scope.(*scope), []string{}, []string{}, 0, RenderManifestsOptions{YamlOutputType: YamlOutputTypeFilePerScope})
+	// the subtree of a scope with its own output type is rendered to a single file named after the scope
+	if want := []string{"app", "app-db", "other"}; !slices.Equal(internal.MapKeysSorted(files), want) {
+		t.Errorf("files = %v, want %v", internal.MapKeysSorted(files), want)
+	}
+}
+
+func TestCustomFilenameRejectsInvalidPaths(t *testing.T) {
+	for _, filePath := range []string{"", ".yaml", "/etc/app", "..", "../escaped/x", "app/../../x", "app/.yaml"} {
+		t.Run(filePath, func(t *testing.T) {
+			defer func() {
+				if r := recover(); r == nil {
+					t.Errorf("expected a panic for the path '%s'", filePath)
+				}
+			}()
+			files := map[string][]ApiObject{}
+			opts := RenderManifestsOptions{Filename: func(FilenameInfo) string { return filePath }}
+			constructFilenameToApiObjectsMap(files, newTestTree().(*builder).Scope.(*scope), []string{}, []string{}, 0, opts)
+		})
+	}
+}
+
+func TestFolderOutputTypesRejectSameFilename(t *testing.T) {
+	for _, opts := range []RenderManifestsOptions{
+		{YamlOutputType: YamlOutputTypeFolderPerNamespace},
+		{YamlOutputType: YamlOutputTypeFolderPerKind},
+		{YamlOutputType: YamlOutputTypeFolderPerKind, IncludeNumberInFilenames: true},
+	} {
+		t.Run(string(opts.YamlOutputType), func(t *testing.T) {
+			b := newTestTree()
+			// a ConfigMap with the same name in another scope of the same namespace
+			addTestConfigMap(b.CreateScope("other", ScopeProps{Namespace: "app"}), "config")
+			defer func() {
+				if r := recover(); r == nil {
+					t.Error("expected a panic for objects of different scopes with the same filename")
+				}
+			}()
+			files := map[string][]ApiObject{}
+			constructFilenameToApiObjectsMap(files, b.(*builder).Scope.(*scope), []string{}, []string{}, 0, opts)
+		})
+	}
+}
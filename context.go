@@ -17,3 +17,5 @@ func GenerateContextKey() string {
 }
 
 var namespaceContextKey = GenerateContextKey()
+
+var yamlOutputTypeContextKey = GenerateContextKey()
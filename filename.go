@@ -0,0 +1,73 @@
+package kgen
+
+import (
+	"bytes"
+	"path"
+	"slices"
+	"strings"
+	"text/template"
+)
+
+// FilenameInfo is the information passed to RenderManifestsOptions.Filename to name the file an object is written to.
+type FilenameInfo struct {
+	// ScopePath is the list of scope IDs from the top-level scope down to the scope the object was added to.
+	ScopePath []string
+	// ScopeIndex is the position (starting from 1) of the scope among its siblings.
+	ScopeIndex int
+	// Index is the position (starting from 1) of the object in its scope.
+	Index int
+	// Group is the API group of the object.
+	Group string
+	// Kind is the kind of the object.
+	Kind string
+	// Namespace is the namespace of the object. It is empty for cluster-scoped objects.
+	Namespace string
+	// Name is the name of the object.
+	Name string
+	// ApiObject is the object being rendered.
+	ApiObject ApiObject
+}
+
+// FilenameTemplate returns a function that can be used as RenderManifestsOptions.Filename, which names files by executing the given Go template with a FilenameInfo.
+// Besides the builtin template functions, "lower", "upper" and "join" (strings.Join) are available.
+// For example: `{{ or .Namespace "_cluster" }}/{{ lower .Kind }}/{{ .Name }}.yaml`.
+func FilenameTemplate(text string) func(FilenameInfo) string {
+	tmpl := template.Must(template.New("filename").Funcs(template.FuncMap{
+		"lower": strings.ToLower,
+		"upper": strings.ToUpper,
+		"join":  strings.Join,
+	}).Parse(text))
+	return func(info FilenameInfo) string {
+		b := bytes.NewBuffer(nil)
+		if err := tmpl.Execute(b, info); err != nil {
+			info.ApiObject.(*apiObject).globalContext.logger.Panicf("FilenameTemplate: %v", err)
+		}
+		return b.String()
+	}
+}
+
+func (s *scope) customFilename(i int, apiObject ApiObject, filenameFn func(FilenameInfo) string) string {
+	info := FilenameInfo{
+		Index:     i + 1,
+		Group:     apiObject.GetObject().GetObjectKind().GroupVersionKind().Group,
+		Kind:      apiObject.GetKind(),
+		Namespace: apiObject.GetNamespace(),
+		Name:      apiObject.GetName(),
+		ScopePath: s.Path(),
+		ApiObject: apiObject,
+	}
+	if s.parent != nil {
+		info.ScopeIndex = slices.Index(s.parent.children, s) + 1
+	}
+	rawPath := filenameFn(info)
+	filePath := path.Clean(rawPath)
+	// the extension is added while writing the files
+	for _, ext := range []string{".yaml", ".yml"} {
+		filePath = strings.TrimSuffix(filePath, ext)
+	}
+	// the files are written to Outdir, which the path must not escape
+	if rawPath == "" || path.IsAbs(filePath) || filePath == ".." || strings.HasPrefix(filePath, "../") || strings.HasSuffix(filePath, "/") || slices.Contains([]string{"", "."}, path.Base(filePath)) {
+		s.Logger().Panicf("Filename: invalid path '%s' for %s '%s': it must be a non-empty file path relative to Outdir", rawPath, apiObject.GetKind(), apiObject.GetName())
+	}
+	return filePath
+}
@@ -0,0 +1,46 @@
+// Command kgen-helm-values generates a Go struct for the values of a helm chart, to be passed as kaddons.HelmChartProps.Values.
+//
+// Usage:
+//
+//	go run github.com/blesswinsamuel/kgen/kaddons/cmd/kgen-helm-values -chart <chart.tgz or dir> [-package values] [-type DemoValues] [-o values.go]
+//
+// The chart can be a tarball from the kaddons cache (Options.CacheDir + "/helm-charts") or an unpacked chart directory.
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"github.com/blesswinsamuel/kgen/kaddons"
+)
+
+func main() {
+	chartPath := flag.String("chart", "", "path of the chart tarball or directory (required)")
+	pkg := flag.String("package", "values", "package name of the generated file")
+	typeName := flag.String("type", "", "name of the generated struct (default is the chart name followed by Values)")
+	output := flag.String("o", "", "output file (default is stdout)")
+	flag.Parse()
+	if *chartPath == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	src, err := kaddons.GenerateHelmValuesStruct(kaddons.HelmValuesStructOptions{
+		ChartPath: *chartPath,
+		Package:   *pkg,
+		TypeName:  *typeName,
+	})
+	if err != nil {
+		log.Fatalf("failed to generate values struct: %v", err)
+	}
+	if *output == "" {
+		if _, err := os.Stdout.Write(src); err != nil {
+			log.Fatalf("failed to write values struct: %v", err)
+		}
+		return
+	}
+	if err := os.WriteFile(*output, src, 0644); err != nil {
+		log.Fatalf("failed to write values struct: %v", err)
+	}
+}
@@ -0,0 +1,119 @@
+package kaddons
+
+import (
+	"errors"
+	"fmt"
+	"path"
+
+	"github.com/blesswinsamuel/kgen"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// ErrDropObject can be returned by the PatchObject function of HelmChartProps and KustomizationProps to drop the object instead of adding it to the scope.
+var ErrDropObject = errors.New("drop object")
+
+// ObjectFilter matches objects by group, version, kind, name, namespace and labels. Empty fields match any object.
+type ObjectFilter struct {
+	// Group is the API group of the object (e.g. "policy").
+	Group string
+	// Version is the API version of the object (e.g. "v1beta1").
+	Version string
+	// Kind is the kind of the object (e.g. "PodSecurityPolicy").
+	Kind string
+	// Name is the name of the object. It can be a pattern (see path.Match), e.g. "*-test".
+	Name string
+	// Namespace is the namespace of the object. It can be a pattern (see path.Match).
+	Namespace string
+	// LabelSelector selects the object by its labels, in the same format as kubectl --selector (e.g. "app.kubernetes.io/component=test").
+	LabelSelector string
+}
+
+func (f ObjectFilter) matches(object runtime.Object) (bool, error) {
+	gvk := object.GetObjectKind().GroupVersionKind()
+	if (f.Group != "" && f.Group != gvk.Group) || (f.Version != "" && f.Version != gvk.Version) || (f.Kind != "" && f.Kind != gvk.Kind) {
+		return false, nil
+	}
+	accessor, err := meta.Accessor(object)
+	if err != nil {
+		return false, fmt.Errorf("failed to access object metadata: %w", err)
+	}
+	for _, pattern := range []struct{ pattern, value string }{{f.Name, accessor.GetName()}, {f.Namespace, accessor.GetNamespace()}} {
+		if pattern.pattern == "" {
+			continue
+		}
+		if matched, err := path.Match(pattern.pattern, pattern.value); err != nil {
+			return false, fmt.Errorf("invalid pattern '%s': %w", pattern.pattern, err)
+		} else if !matched {
+			return false, nil
+		}
+	}
+	if f.LabelSelector != "" {
+		selector, err := labels.Parse(f.LabelSelector)
+		if err != nil {
+			return false, fmt.Errorf("invalid label selector '%s': %w", f.LabelSelector, err)
+		}
+		if !selector.Matches(labels.Set(accessor.GetLabels())) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// setObjectNamespace sets the namespace on the namespaced object if it has none, so that filters, patches and the scope see the namespace
+// the object is deployed to. clusterScoped holds the kinds defined by the CRDs added along with the object (see clusterScopedCRDKinds).
+func setObjectNamespace(scope kgen.Scope, object runtime.Object, namespace string, clusterScoped map[schema.GroupKind]bool) error {
+	accessor, err := meta.Accessor(object)
+	if err != nil {
+		return fmt.Errorf("failed to access object metadata: %w", err)
+	}
+	groupKind := object.GetObjectKind().GroupVersionKind().GroupKind()
+	if namespace != "" && accessor.GetNamespace() == "" && !clusterScoped[groupKind] && !scope.IsClusterScoped(groupKind) {
+		accessor.SetNamespace(namespace)
+	}
+	return nil
+}
+
+// clusterScopedCRDKinds returns the kinds defined by the cluster-scoped CustomResourceDefinitions among the objects.
+// The scope only learns them when the CRDs are added, which is after the namespace is set on the objects added along with them.
+func clusterScopedCRDKinds(objects []runtime.Object) map[schema.GroupKind]bool {
+	kinds := map[schema.GroupKind]bool{}
+	for _, object := range objects {
+		obj, ok := object.(*unstructured.Unstructured)
+		if !ok || obj.GroupVersionKind().GroupKind() != (schema.GroupKind{Group: "apiextensions.k8s.io", Kind: "CustomResourceDefinition"}) {
+			continue
+		}
+		crdScope, _, _ := unstructured.NestedString(obj.Object, "spec", "scope")
+		group, _, _ := unstructured.NestedString(obj.Object, "spec", "group")
+		kind, _, _ := unstructured.NestedString(obj.Object, "spec", "names", "kind")
+		if crdScope == "Cluster" {
+			kinds[schema.GroupKind{Group: group, Kind: kind}] = true
+		}
+	}
+	return kinds
+}
+
+// filterObject returns whether the object matches one of the include filters (if any) and none of the exclude filters.
+func filterObject(object runtime.Object, include []ObjectFilter, exclude []ObjectFilter) (bool, error) {
+	included := len(include) == 0
+	for _, filter := range include {
+		if matched, err := filter.matches(object); err != nil {
+			return false, err
+		} else if matched {
+			included = true
+			break
+		}
+	}
+	if !included {
+		return false, nil
+	}
+	for _, filter := range exclude {
+		if matched, err := filter.matches(object); err != nil || matched {
+			return false, err
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,99 @@
+package kaddons
+
+import (
+	"maps"
+	"testing"
+
+	"github.com/blesswinsamuel/kgen"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+)
+
+func newTestObject(apiVersion, kind, namespace, name string, labels map[string]any) *unstructured.Unstructured {
+	metadata := map[string]any{"name": name}
+	if namespace != "" {
+		metadata["namespace"] = namespace
+	}
+	if labels != nil {
+		metadata["labels"] = labels
+	}
+	return &unstructured.Unstructured{Object: map[string]any{"apiVersion": apiVersion, "kind": kind, "metadata": metadata}}
+}
+
+func TestFilterObject(t *testing.T) {
+	deployment := newTestObject("apps/v1", "Deployment", "web", "web-test", map[string]any{"app.kubernetes.io/component": "test"})
+	tests := []struct {
+		name    string
+		include []ObjectFilter
+		exclude []ObjectFilter
+		want    bool
+		wantErr bool
+	}{
+		{name: "no filters", want: true},
+		{name: "include kind", include: []ObjectFilter{{Kind: "Service"}, {Group: "apps", Kind: "Deployment"}}, want: true},
+		{name: "include other group", include: []ObjectFilter{{Group: "extensions", Kind: "Deployment"}}, want: false},
+		{name: "include version", include: []ObjectFilter{{Version: "v1beta1"}}, want: false},
+		{name: "exclude name pattern", exclude: []ObjectFilter{{Name: "*-test"}}, want: false},
+		{name: "exclude other name", exclude: []ObjectFilter{{Name: "db-*"}}, want: true},
+		{name: "include namespace pattern", include: []ObjectFilter{{Namespace: "w*"}}, want: true},
+		{name: "exclude label selector", exclude: []ObjectFilter{{LabelSelector: "app.kubernetes.io/component=test"}}, want: false},
+		{name: "include label selector", include: []ObjectFilter{{LabelSelector: "app.kubernetes.io/component!=test"}}, want: false},
+		{name: "exclude wins", include: []ObjectFilter{{Kind: "Deployment"}}, exclude: []ObjectFilter{{Namespace: "web"}}, want: false},
+		{name: "invalid pattern", include: []ObjectFilter{{Name: "["}}, wantErr: true},
+		{name: "invalid label selector", exclude: []ObjectFilter{{LabelSelector: "a=b=c"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := filterObject(deployment, tt.include, tt.exclude)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("filterObject() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("filterObject() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddHelmChartObjectsFiltersByEffectiveNamespace(t *testing.T) {
+	builder := kgen.NewBuilder(kgen.BuilderOptions{SchemeBuilder: runtime.SchemeBuilder{clientgoscheme.AddToScheme}})
+	scope := builder.CreateScope("app", kgen.ScopeProps{Namespace: "app"})
+	objects := []helmObject{
+		{object: newTestObject("v1", "ConfigMap", "", "config", nil)},
+		{object: newTestObject("v1", "ConfigMap", "other", "other-config", nil)},
+		{object: newTestObject("rbac.authorization.k8s.io/v1", "ClusterRole", "", "role", nil)},
+	}
+	addHelmChartObjects(scope, HelmChartProps{ReleaseName: "app", Namespace: "release", Exclude: []ObjectFilter{{Namespace: "release"}}}, objects)
+	got := map[string]string{}
+	scope.WalkApiObjects(func(object kgen.ApiObject) error {
+		got[object.GetName()] = object.GetNamespace()
+		return nil
+	})
+	want := map[string]string{"other-config": "other", "role": ""}
+	if len(got) != len(want) || got["other-config"] != want["other-config"] || got["role"] != want["role"] {
+		t.Errorf("objects = %v, want %v", got, want)
+	}
+}
+
+func TestAddHelmChartObjectsLearnsClusterScopedCRDs(t *testing.T) {
+	builder := kgen.NewBuilder(kgen.BuilderOptions{SchemeBuilder: runtime.SchemeBuilder{clientgoscheme.AddToScheme}})
+	scope := builder.CreateScope("app", kgen.ScopeProps{Namespace: "app"})
+	crd := newTestObject("apiextensions.k8s.io/v1", "CustomResourceDefinition", "", "clusterissuers.cert-manager.io", nil)
+	crd.Object["spec"] = map[string]any{"group": "cert-manager.io", "scope": "Cluster", "names": map[string]any{"kind": "ClusterIssuer"}}
+	objects := []helmObject{
+		{object: newTestObject("cert-manager.io/v1", "ClusterIssuer", "", "letsencrypt", nil)},
+		{object: crd},
+		{object: newTestObject("v1", "ConfigMap", "", "config", nil)},
+	}
+	addHelmChartObjects(scope, HelmChartProps{ReleaseName: "app", Namespace: "app"}, objects)
+	got := map[string]string{}
+	scope.WalkApiObjects(func(object kgen.ApiObject) error {
+		got[object.GetKind()] = object.GetNamespace()
+		return nil
+	})
+	want := map[string]string{"ClusterIssuer": "", "CustomResourceDefinition": "", "ConfigMap": "app"}
+	if !maps.Equal(got, want) {
+		t.Errorf("namespaces = %v, want %v", got, want)
+	}
+}
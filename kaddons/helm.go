@@ -1,46 +1,103 @@
 package kaddons
 
 import (
-	"bufio"
 	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
+	"maps"
 	"os"
 	"os/exec"
 	"path"
+	"slices"
 	"strings"
+	"sync"
 
 	"github.com/blesswinsamuel/kgen"
-	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/apimachinery/pkg/util/yaml"
 )
 
 // HelmChartInfo represents the information required to fetch a helm chart
 type HelmChartInfo struct {
-	// Repo is the helm chart repository
+	// Repo is the helm chart repository. OCI registries are supported with the oci:// scheme (e.g. oci://ghcr.io/org/charts).
 	Repo string
 	// Chart is the helm chart name
 	Chart string
 	// Version is the helm chart version
 	Version string
+	// PlainHTTP uses HTTP instead of HTTPS to pull charts from an OCI registry (e.g. a local registry).
+	PlainHTTP bool
+}
+
+// isOCI returns whether the chart is hosted in an OCI registry.
+func (c HelmChartInfo) isOCI() bool {
+	return strings.HasPrefix(c.Repo, "oci://")
+}
+
+// chartRef returns the chart reference passed to helm pull: the chart name for HTTP repos, and the full reference for OCI registries.
+func (c HelmChartInfo) chartRef() string {
+	if c.isOCI() {
+		return strings.TrimSuffix(c.Repo, "/") + "/" + c.Chart
+	}
+	return c.Chart
 }
 
 // HelmChartProps represents the properties required to add a helm chart to the scope.
 type HelmChartProps struct {
 	// ChartInfo is the information required to fetch a helm chart.
 	ChartInfo HelmChartInfo
+	// ChartPath is the path to a local chart, either an unpacked chart directory or a .tgz file.
+	// If set, ChartInfo is ignored and the chart is templated directly from disk without being fetched.
+	ChartPath string
 	// ChartFileNamePrefix is the prefix to be used for the chart file name.
 	ChartFileNamePrefix string
 	// ReleaseName is the release name to be used while executing helm template.
 	ReleaseName string
 	// Namespace is the namespace to be used while executing helm template. Defaults to the scope's namespace.
+	// It is set on the namespaced objects that don't have one, before Include, Exclude and PatchObject.
 	Namespace string
-	// Values is the values to be passed to helm template.
-	Values map[string]interface{}
+	// Values is the values to be passed to helm template. They override the values from ValuesFiles.
+	// It can be a map or any Go struct, which is marshalled using its json tags.
+	// The values are validated against the chart's values.schema.json (if present) before templating.
+	Values any
+	// ValuesFiles are values files passed to helm template (--values), before Values.
+	ValuesFiles []string
+	// SetString sets values as strings (--set-string), overriding Values. Keys can be nested with dots (e.g. "image.tag").
+	SetString map[string]string
+	// SetFile sets values from the content of files (--set-file), overriding Values. The map is from key to file path.
+	SetFile map[string]string
+	// KubeVersion is the kubernetes version used for Capabilities.KubeVersion (--kube-version). Defaults to Options.HelmKubeVersion.
+	KubeVersion string
+	// APIVersions are the kubernetes api versions used for Capabilities.APIVersions (--api-versions).
+	APIVersions []string
+	// IncludeHooks includes the hooks in the templated output. By default, hooks are dropped (--no-hooks).
+	IncludeHooks bool
+	// Hooks translates the helm hooks into the annotations of a deploy tool (see HelmHooksArgoCD and HelmHooksKapp), instead of dropping them.
+	// Setting it implies IncludeHooks.
+	Hooks helmHooksMode
+	// IncludeTests includes the test hooks in the templated output, when IncludeHooks is set. By default, tests are dropped (--skip-tests).
+	IncludeTests bool
+	// SkipCRDs drops the CRDs in the chart's crds directory from the templated output. By default, they are included (--include-crds).
+	SkipCRDs bool
+	// PostRenderer is the path to an executable used as a post renderer (--post-renderer).
+	PostRenderer string
+	// PostRendererArgs are the arguments passed to PostRenderer (--post-renderer-args).
+	PostRendererArgs []string
+	// ReleaseScope places the objects in a child scope named after the release, instead of adding them to the scope directly.
+	ReleaseScope bool
+	// SubchartScopes places the objects of the chart's subcharts in child scopes named after the subcharts (nested for subcharts of subcharts),
+	// based on the template they were generated from. The objects of the chart itself are added to the scope.
+	SubchartScopes bool
+	// SourceScopes places the objects in child scopes named after the template they were generated from
+	// (e.g. "deployment" for templates/deployment.yaml), under the release and subchart scopes if enabled.
+	// Combined with YamlOutputTypeFilePerScope, it produces a file per template.
+	SourceScopes bool
+	// Include keeps only the objects matching one of the filters. Default is nil (all objects are kept).
+	Include []ObjectFilter
+	// Exclude drops the objects matching one of the filters, e.g. a bundled PodSecurityPolicy or a NetworkPolicy managed elsewhere.
+	Exclude []ObjectFilter
 	// PatchObject is the function to be used to patch the object before adding it to the scope. Default is nil.
+	// Returning ErrDropObject drops the object.
 	PatchObject func(obj runtime.Object) error
 }
 
@@ -50,84 +107,323 @@ func AddHelmChart(scope kgen.Scope, props HelmChartProps) {
 	if props.Namespace == "" {
 		props.Namespace = scope.Namespace()
 	}
-	objects, err := execHelmTemplateAndGetObjects(helmTemplateOptions{
+	if props.KubeVersion == "" {
+		props.KubeVersion = opts.HelmKubeVersion
+	}
+	templateCacheDir := ""
+	if opts.CacheHelmTemplates {
+		templateCacheDir = path.Join(opts.CacheDir, "helm-templates")
+	}
+	templateOpts := helmTemplateOptions{
 		ChartInfo:           props.ChartInfo,
+		ChartPath:           props.ChartPath,
 		Namespace:           props.Namespace,
 		ChartFileNamePrefix: props.ChartFileNamePrefix,
 		ReleaseName:         props.ReleaseName,
 		Values:              props.Values,
+		ValuesFiles:         props.ValuesFiles,
+		SetString:           props.SetString,
+		SetFile:             props.SetFile,
+		APIVersions:         props.APIVersions,
+		IncludeHooks:        props.IncludeHooks || props.Hooks != "",
+		IncludeTests:        props.IncludeTests,
+		SkipCRDs:            props.SkipCRDs,
+		PostRenderer:        props.PostRenderer,
+		PostRendererArgs:    props.PostRendererArgs,
 		CacheDir:            path.Join(opts.CacheDir, "helm-charts"),
-		HelmKubeVersion:     opts.HelmKubeVersion,
+		HelmKubeVersion:     props.KubeVersion,
+		HelmEngine:          opts.HelmEngine,
+		TemplateCacheDir:    templateCacheDir,
+		LockFile:            opts.LockFile,
+		UpdateLockFile:      opts.UpdateLockFile,
+		Offline:             opts.Offline && !opts.prefetchOnly,
+		PrefetchOnly:        opts.prefetchOnly,
 		Logger:              opts.logger,
-	})
+	}
+	if opts.DeferHelmCharts {
+		getDeferredHelmCharts(scope).add(deferredHelmChart{scope: asDeferringScope(scope).Placeholder(), props: props, templateOpts: templateOpts})
+		return
+	}
+	objects, err := execHelmTemplateAndGetObjects(templateOpts)
 	if err != nil {
-		scope.Logger().Panicf("failed to execute helm template: %v", err)
+		scope.Logger().Panicf("failed to execute helm template for release '%s' in scope '%s': %v", props.ReleaseName, strings.Join(scope.Path(), "/"), err)
+	}
+	addHelmChartObjects(scope, props, objects)
+}
+
+func addHelmChartObjects(scope kgen.Scope, props HelmChartProps, objects []helmObject) {
+	runtimeObjects := []runtime.Object{}
+	for _, object := range objects {
+		runtimeObjects = append(runtimeObjects, object.object)
 	}
+	clusterScoped := clusterScopedCRDKinds(runtimeObjects)
+	objects = slices.DeleteFunc(objects, func(object helmObject) bool {
+		// helm install sets the release namespace on the objects without one
+		if err := setObjectNamespace(scope, object.object, props.Namespace, clusterScoped); err != nil {
+			scope.Logger().Panicf("failed to set namespace: %v", err)
+		}
+		keep, err := filterObject(object.object, props.Include, props.Exclude)
+		if err != nil {
+			scope.Logger().Panicf("failed to filter objects: %v", err)
+		}
+		return !keep
+	})
+	if props.Hooks != "" {
+		objects = translateHelmHooks(scope, props.ReleaseName, props.Hooks, objects)
+	}
+	scopes := helmScopes{}
 	for _, object := range objects {
 		if props.PatchObject != nil {
-			if err := props.PatchObject(object); err != nil {
+			if err := props.PatchObject(object.object); errors.Is(err, ErrDropObject) {
+				continue
+			} else if err != nil {
 				scope.Logger().Panicf("failed to patch object: %v", err)
 			}
 		}
-		scope.AddApiObject(object)
+		objectScope := scope
+		if props.ReleaseScope {
+			objectScope = scopes.child(objectScope, props.ReleaseName)
+		}
+		subcharts, template := helmTemplateSource(object.source)
+		if props.SubchartScopes {
+			for _, subchart := range subcharts {
+				objectScope = scopes.child(objectScope, subchart)
+			}
+		}
+		if props.SourceScopes && template != "" {
+			sourceScopeID := helmSourceScopeID(template)
+			if !props.SubchartScopes {
+				// templates of subcharts would otherwise share the scopes of the chart's templates with the same name
+				sourceScopeID = strings.Join(append(subcharts, sourceScopeID), "-")
+			}
+			objectScope = scopes.child(objectScope, sourceScopeID)
+		}
+		objectScope.AddApiObject(object.object)
 	}
 }
 
 type helmTemplateOptions struct {
 	ChartInfo           HelmChartInfo
+	ChartPath           string
 	ChartFileNamePrefix string
 	ReleaseName         string
 	Namespace           string
-	Values              map[string]interface{}
+	Values              any
+	ValuesFiles         []string
+	SetString           map[string]string
+	SetFile             map[string]string
+	APIVersions         []string
+	IncludeHooks        bool
+	IncludeTests        bool
+	SkipCRDs            bool
+	PostRenderer        string
+	PostRendererArgs    []string
 
 	CacheDir        string
 	HelmKubeVersion string
-	Logger          kgen.Logger
+	HelmEngine      helmEngine
+	// TemplateCacheDir is the directory the output of helm template is cached in. Caching is disabled if empty.
+	TemplateCacheDir string
+	LockFile         string
+	UpdateLockFile   bool
+	Offline          bool
+	PrefetchOnly     bool
+	Logger           kgen.Logger
+}
+
+// helmRunner fetches and templates helm charts.
+type helmRunner interface {
+	// pull downloads the chart tarball to the destination directory.
+	pull(props helmTemplateOptions, destination string) error
+	// dependencyBuild downloads the dependencies of the unpacked chart at chartDir into its charts directory, as helm dependency build does.
+	dependencyBuild(props helmTemplateOptions, chartDir string) error
+	// template renders the chart and returns the manifests, as printed by helm template.
+	template(props helmTemplateOptions, chartPath string, valuesJson []byte) ([]byte, error)
+	// version returns the version of helm rendering the charts, which is part of the helm template cache key.
+	version() (string, error)
 }
 
-func execHelmTemplateAndGetObjects(props helmTemplateOptions) ([]runtime.Object, error) {
+func getHelmRunner(engine helmEngine) (helmRunner, error) {
+	switch engine {
+	case HelmEngineCLI, "":
+		if _, err := exec.LookPath("helm"); err != nil {
+			return nil, fmt.Errorf("helm not found in PATH: %w", err)
+		}
+		return helmCLI{}, nil
+	case HelmEngineSDK:
+		return helmSDK{}, nil
+	default:
+		return nil, fmt.Errorf("unknown helm engine '%s'", engine)
+	}
+}
+
+func execHelmTemplateAndGetObjects(props helmTemplateOptions) ([]helmObject, error) {
 	if props.Logger == nil {
 		props.Logger = kgen.NewCustomLogger(nil)
 	}
 	if err := os.MkdirAll(props.CacheDir, os.ModePerm); err != nil {
 		return nil, fmt.Errorf("MkdirAll failed: %w", err)
 	}
-	if _, err := exec.LookPath("helm"); err != nil {
-		return nil, fmt.Errorf("helm not found in PATH: %w", err)
+	runner, err := getHelmRunner(props.HelmEngine)
+	if err != nil {
+		return nil, err
+	}
+	chartPath, err := getHelmChartPath(runner, props)
+	if err != nil {
+		return nil, err
+	}
+	chartPath, err = resolveHelmChartDependencies(runner, props, chartPath)
+	if err != nil {
+		return nil, err
+	}
+	if props.PrefetchOnly {
+		return nil, nil
+	}
+	valuesJson, err := json.Marshal(props.Values)
+	if err != nil {
+		return nil, fmt.Errorf("json marshal failed: %w", err)
+	}
+	if err := validateHelmValues(props, chartPath, valuesJson); err != nil {
+		return nil, err
+	}
+	var out []byte
+	if props.TemplateCacheDir != "" {
+		out, err = templateWithCache(runner, props, chartPath, valuesJson)
+	} else {
+		out, err = runner.template(props, chartPath, valuesJson)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	objects, err := decodeHelmObjects(out)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding helm template output: %w", err)
+	}
+	return objects, nil
+}
+
+// getHelmChartPath returns the path of the chart to template, fetching it into the cache if needed.
+func getHelmChartPath(runner helmRunner, props helmTemplateOptions) (string, error) {
+	if props.ChartPath != "" {
+		if _, err := os.Stat(props.ChartPath); err != nil {
+			return "", fmt.Errorf("local chart not found: %w", err)
+		}
+		return props.ChartPath, nil
 	}
 	if props.ChartInfo.Repo == "" {
-		return nil, errors.New("helm chart repo is empty")
+		return "", errors.New("helm chart repo is empty")
 	}
 	if props.ChartInfo.Chart == "" {
-		return nil, errors.New("helm chart name is empty")
+		return "", errors.New("helm chart name is empty")
 	}
 	if props.ChartInfo.Version == "" {
-		return nil, errors.New("helm chart version is empty")
+		return "", errors.New("helm chart version is empty")
 	}
 	chartFileName := props.ChartInfo.Chart + "-" + props.ChartInfo.Version + ".tgz"
 	if props.ChartFileNamePrefix != "" {
 		chartFileName = props.ChartFileNamePrefix + props.ChartInfo.Version + ".tgz"
 	}
-	chartPath := path.Join(props.CacheDir, chartFileName)
+	chartDir := props.CacheDir
+	if props.ChartInfo.isOCI() {
+		// OCI charts are cached under their registry path, as different registries can host charts with the same name
+		registryPath := strings.TrimPrefix(strings.TrimSuffix(props.ChartInfo.Repo, "/"), "oci://")
+		chartDir = path.Join(props.CacheDir, "oci", strings.ReplaceAll(registryPath, ":", "_"))
+	}
+	chartPath := path.Join(chartDir, chartFileName)
+	// charts can be fetched concurrently (see Options.DeferHelmCharts)
+	unlock := lockHelmChartPath(chartPath)
+	defer unlock()
+	if props.Offline && props.UpdateLockFile {
+		return "", errors.New("the lockfile can't be updated in offline mode")
+	}
+	if props.LockFile != "" && props.UpdateLockFile {
+		// pull the chart again to refresh its digest
+		if err := os.Remove(chartPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return "", fmt.Errorf("failed to remove cached chart: %w", err)
+		}
+	}
 	if _, err := os.Stat(chartPath); err != nil {
 		if errors.Is(err, os.ErrNotExist) {
+			if props.Offline {
+				return "", fmt.Errorf("chart '%s' version '%s' from repo '%s' is not in the cache (%s) and offline mode is enabled; populate the cache with PrefetchHelmCharts", props.ChartInfo.Chart, props.ChartInfo.Version, props.ChartInfo.Repo, chartPath)
+			}
 			props.Logger.Infof("Fetching chart '%s' from repo '%s' version '%s'...", props.ChartInfo.Chart, props.ChartInfo.Repo, props.ChartInfo.Version)
-			cmd := exec.Command("helm", "pull", props.ChartInfo.Chart, "--repo", props.ChartInfo.Repo, "--destination", props.CacheDir, "--version", props.ChartInfo.Version)
-			if out, err := cmd.CombinedOutput(); err != nil {
-				fmt.Println(string(out))
-				return nil, fmt.Errorf("helm pull failed: %w", err)
-			} else {
-				if len(out) > 0 {
-					fmt.Println(string(out))
-					props.Logger.Warnf("Received unexpected output from helm pull command for chart '%s'", props.ChartInfo.Chart)
-				}
+			if err := os.MkdirAll(chartDir, os.ModePerm); err != nil {
+				return "", fmt.Errorf("MkdirAll failed: %w", err)
+			}
+			if err := runner.pull(props, chartDir); err != nil {
+				return "", err
 			}
 		} else {
-			return nil, fmt.Errorf("error occured while checking if chart exists in cache: %w", err)
+			return "", fmt.Errorf("error occured while checking if chart exists in cache: %w", err)
+		}
+	}
+	if props.LockFile != "" {
+		if err := verifyHelmChartDigest(props.LockFile, props.UpdateLockFile, props.ChartInfo, chartPath); err != nil {
+			return "", err
+		}
+	}
+	return chartPath, nil
+}
+
+// helmCLI runs the helm binary.
+type helmCLI struct{}
+
+func (helmCLI) pull(props helmTemplateOptions, destination string) error {
+	args := []string{"pull", props.ChartInfo.chartRef(), "--destination", destination, "--version", props.ChartInfo.Version}
+	if props.ChartInfo.isOCI() {
+		if props.ChartInfo.PlainHTTP {
+			args = append(args, "--plain-http")
+		}
+	} else {
+		args = append(args, "--repo", props.ChartInfo.Repo)
+	}
+	cmd := exec.Command("helm", args...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		fmt.Println(string(out))
+		return fmt.Errorf("helm pull failed: %w", err)
+	} else {
+		// helm pull prints the pulled reference and digest for OCI charts
+		if len(out) > 0 && !props.ChartInfo.isOCI() {
+			fmt.Println(string(out))
+			props.Logger.Warnf("Received unexpected output from helm pull command for chart '%s'", props.ChartInfo.Chart)
 		}
 	}
-	cmd := exec.Command(
-		"helm",
+	return nil
+}
+
+func (helmCLI) dependencyBuild(props helmTemplateOptions, chartDir string) error {
+	cmd := exec.Command("helm", "dependency", "build", chartDir)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		fmt.Println(string(out))
+		return fmt.Errorf("helm dependency build failed: %w", err)
+	}
+	return nil
+}
+
+// helmCLIVersions caches the output of helm version per helm binary.
+var helmCLIVersions sync.Map
+
+func (helmCLI) version() (string, error) {
+	helmPath, err := exec.LookPath("helm")
+	if err != nil {
+		return "", fmt.Errorf("helm not found in PATH: %w", err)
+	}
+	if version, ok := helmCLIVersions.Load(helmPath); ok {
+		return version.(string), nil
+	}
+	out, err := exec.Command(helmPath, "version", "--short").Output()
+	if err != nil {
+		return "", fmt.Errorf("helm version failed: %w", err)
+	}
+	version := strings.TrimSpace(string(out))
+	helmCLIVersions.Store(helmPath, version)
+	return version, nil
+}
+
+func (helmCLI) template(props helmTemplateOptions, chartPath string, valuesJson []byte) ([]byte, error) {
+	args := []string{
 		"template",
 		props.ReleaseName,
 		chartPath,
@@ -135,17 +431,37 @@ func execHelmTemplateAndGetObjects(props helmTemplateOptions) ([]runtime.Object,
 		props.Namespace,
 		"--kube-version",
 		props.HelmKubeVersion,
-		"--include-crds",
-		"--skip-tests",
-		"--no-hooks",
-		"--values",
-		"-",
-	)
-	valuesJson, err := json.Marshal(props.Values)
-	if err != nil {
-		return nil, fmt.Errorf("json marshal failed: %w", err)
 	}
-	cmd.Stdin = strings.NewReader(string(valuesJson))
+	for _, apiVersion := range props.APIVersions {
+		args = append(args, "--api-versions", apiVersion)
+	}
+	if !props.SkipCRDs {
+		args = append(args, "--include-crds")
+	}
+	if !props.IncludeTests {
+		args = append(args, "--skip-tests")
+	}
+	if !props.IncludeHooks {
+		args = append(args, "--no-hooks")
+	}
+	for _, valuesFile := range props.ValuesFiles {
+		args = append(args, "--values", valuesFile)
+	}
+	args = append(args, "--values", "-")
+	for _, setValue := range helmSetValues(props.SetString) {
+		args = append(args, "--set-string", setValue)
+	}
+	for _, setValue := range helmSetValues(props.SetFile) {
+		args = append(args, "--set-file", setValue)
+	}
+	if props.PostRenderer != "" {
+		args = append(args, "--post-renderer", props.PostRenderer)
+		for _, arg := range props.PostRendererArgs {
+			args = append(args, "--post-renderer-args", arg)
+		}
+	}
+	cmd := exec.Command("helm", args...)
+	cmd.Stdin = bytes.NewReader(valuesJson)
 	out, err := cmd.Output()
 	if err != nil {
 		if ee, ok := err.(*exec.ExitError); ok {
@@ -153,31 +469,16 @@ func execHelmTemplateAndGetObjects(props helmTemplateOptions) ([]runtime.Object,
 		}
 		return nil, fmt.Errorf("helm template failed: %w", err)
 	}
+	return out, nil
+}
 
-	reader := yaml.NewYAMLReader(bufio.NewReader(bytes.NewReader(out)))
-	var objects []runtime.Object
-	for {
-		var obj map[string]any
-
-		bytes, err := reader.Read()
-		if err != nil {
-			if err == io.EOF {
-				break
-			}
-			return nil, fmt.Errorf("error decoding yaml: %w", err)
-		}
-		if len(bytes) == 0 {
-			continue
-		}
-
-		if err := yaml.Unmarshal(bytes, &obj); err != nil {
-			return nil, fmt.Errorf("error decoding yaml: %w", err)
-		}
-		if len(obj) == 0 {
-			continue
-		}
-		runtimeObj := &unstructured.Unstructured{Object: obj}
-		objects = append(objects, runtimeObj)
+// helmSetValues converts a map of values to the key=value format of the --set-* flags of helm, sorted by key.
+// Commas and backslashes in the values are escaped, so that each entry sets a single value.
+func helmSetValues(values map[string]string) []string {
+	setValues := []string{}
+	for _, key := range slices.Sorted(maps.Keys(values)) {
+		value := strings.NewReplacer(`\`, `\\`, ",", `\,`).Replace(values[key])
+		setValues = append(setValues, key+"="+value)
 	}
-	return objects, nil
+	return setValues
 }
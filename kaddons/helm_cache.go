@@ -0,0 +1,172 @@
+package kaddons
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+)
+
+// helmTemplateCacheKey holds everything that affects the output of helm template. Its hash is the name of the cache entry.
+type helmTemplateCacheKey struct {
+	// FormatVersion is bumped when the format of the cache entries changes.
+	FormatVersion int
+	ChartDigest   string
+	Engine        helmEngine
+	// EngineVersion is the version of the helm binary or SDK, as templates can render differently across helm versions.
+	EngineVersion string
+	ReleaseName   string
+	Namespace     string
+	KubeVersion   string
+	APIVersions   []string
+	IncludeHooks  bool
+	IncludeTests  bool
+	SkipCRDs      bool
+	Values        json.RawMessage
+	// ValuesFiles, SetFile and PostRenderer hold the digests of the files, as their content affects the output.
+	ValuesFiles      []string
+	SetString        map[string]string
+	SetFile          map[string]string
+	PostRenderer     string
+	PostRendererArgs []string
+}
+
+// helmChartDigest returns the digest of a chart tarball, or of the files of an unpacked chart directory.
+func helmChartDigest(chartPath string) (string, error) {
+	info, err := os.Stat(chartPath)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return fileDigest(chartPath)
+	}
+	h := sha256.New()
+	err = filepath.WalkDir(chartPath, func(filePath string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		relPath, err := filepath.Rel(chartPath, filePath)
+		if err != nil {
+			return err
+		}
+		f, err := os.Open(filePath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		fmt.Fprintf(h, "%s\x00", filepath.ToSlash(relPath))
+		_, err = io.Copy(h, f)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// helmTemplateCachePath returns the path of the cache entry holding the output of helm template for the given inputs.
+func helmTemplateCachePath(props helmTemplateOptions, engineVersion string, chartPath string, valuesJson []byte) (string, error) {
+	chartDigest, err := helmChartDigest(chartPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to compute chart digest: %w", err)
+	}
+	valuesFileDigests := []string{}
+	for _, valuesFile := range props.ValuesFiles {
+		digest, err := fileDigest(valuesFile)
+		if err != nil {
+			return "", fmt.Errorf("failed to compute values file digest: %w", err)
+		}
+		valuesFileDigests = append(valuesFileDigests, digest)
+	}
+	setFileDigests := map[string]string{}
+	for key, setFile := range props.SetFile {
+		digest, err := fileDigest(setFile)
+		if err != nil {
+			return "", fmt.Errorf("failed to compute set file digest: %w", err)
+		}
+		setFileDigests[key] = digest
+	}
+	postRendererDigest := ""
+	if props.PostRenderer != "" {
+		postRendererPath, err := exec.LookPath(props.PostRenderer)
+		if err != nil {
+			return "", fmt.Errorf("failed to find post renderer: %w", err)
+		}
+		postRendererDigest, err = fileDigest(postRendererPath)
+		if err != nil {
+			return "", fmt.Errorf("failed to compute post renderer digest: %w", err)
+		}
+	}
+	key, err := json.Marshal(helmTemplateCacheKey{
+		FormatVersion:    1,
+		ChartDigest:      chartDigest,
+		Engine:           props.HelmEngine,
+		EngineVersion:    engineVersion,
+		ReleaseName:      props.ReleaseName,
+		Namespace:        props.Namespace,
+		KubeVersion:      props.HelmKubeVersion,
+		APIVersions:      props.APIVersions,
+		IncludeHooks:     props.IncludeHooks,
+		IncludeTests:     props.IncludeTests,
+		SkipCRDs:         props.SkipCRDs,
+		Values:           valuesJson,
+		ValuesFiles:      valuesFileDigests,
+		SetString:        props.SetString,
+		SetFile:          setFileDigests,
+		PostRenderer:     postRendererDigest,
+		PostRendererArgs: props.PostRendererArgs,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode cache key: %w", err)
+	}
+	hash := sha256.Sum256(key)
+	return path.Join(props.TemplateCacheDir, hex.EncodeToString(hash[:])+".yaml"), nil
+}
+
+// templateWithCache returns the output of helm template from the cache, running it and caching its output on a miss.
+func templateWithCache(runner helmRunner, props helmTemplateOptions, chartPath string, valuesJson []byte) ([]byte, error) {
+	engineVersion, err := runner.version()
+	if err != nil {
+		return nil, err
+	}
+	cachePath, err := helmTemplateCachePath(props, engineVersion, chartPath, valuesJson)
+	if err != nil {
+		return nil, err
+	}
+	if out, err := os.ReadFile(cachePath); err == nil {
+		return out, nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read helm template cache: %w", err)
+	}
+	out, err := runner.template(props, chartPath, valuesJson)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(props.TemplateCacheDir, os.ModePerm); err != nil {
+		return nil, fmt.Errorf("MkdirAll failed: %w", err)
+	}
+	// write to a temporary file first, so that an interrupted run doesn't leave a partial cache entry
+	tmpFile, err := os.CreateTemp(props.TemplateCacheDir, "tmp-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create helm template cache entry: %w", err)
+	}
+	defer os.Remove(tmpFile.Name())
+	if _, err := tmpFile.Write(out); err != nil {
+		tmpFile.Close()
+		return nil, fmt.Errorf("failed to write helm template cache entry: %w", err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write helm template cache entry: %w", err)
+	}
+	if err := os.Rename(tmpFile.Name(), cachePath); err != nil {
+		return nil, fmt.Errorf("failed to write helm template cache entry: %w", err)
+	}
+	return out, nil
+}
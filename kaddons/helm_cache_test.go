@@ -0,0 +1,48 @@
+package kaddons
+
+import (
+	"strings"
+	"testing"
+)
+
+// fakeHelmRunner counts the charts it templates.
+type fakeHelmRunner struct {
+	helmVersion string
+	templated   int
+}
+
+func (r *fakeHelmRunner) pull(helmTemplateOptions, string) error { return nil }
+
+func (r *fakeHelmRunner) dependencyBuild(helmTemplateOptions, string) error { return nil }
+
+func (r *fakeHelmRunner) template(helmTemplateOptions, string, []byte) ([]byte, error) {
+	r.templated++
+	return []byte("# rendered by " + r.helmVersion + "\n"), nil
+}
+
+func (r *fakeHelmRunner) version() (string, error) { return r.helmVersion, nil }
+
+func TestTemplateWithCacheIsKeyedByHelmVersion(t *testing.T) {
+	props := helmTemplateOptions{ReleaseName: "app", Namespace: "app", HelmKubeVersion: "v1.30.2", TemplateCacheDir: t.TempDir()}
+	runner := &fakeHelmRunner{helmVersion: "v3.21.0"}
+	for _, helmVersion := range []string{"v3.21.0", "v3.21.0", "v3.22.0"} {
+		runner.helmVersion = helmVersion
+		out, err := templateWithCache(runner, props, testChartPath, []byte("{}"))
+		if err != nil {
+			t.Fatalf("templateWithCache: %v", err)
+		}
+		if !strings.Contains(string(out), helmVersion) {
+			t.Errorf("output = %q, want the output of helm %s", out, helmVersion)
+		}
+	}
+	if runner.templated != 2 {
+		t.Errorf("templated %d times, want 2 (once per helm version)", runner.templated)
+	}
+}
+
+func TestHelmSDKVersion(t *testing.T) {
+	version, err := helmSDK{}.version()
+	if err != nil || !strings.HasPrefix(version, "helm.sh/helm/v3@v3.") {
+		t.Errorf("version() = %q, %v, want the helm module version", version, err)
+	}
+}
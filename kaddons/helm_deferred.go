@@ -0,0 +1,119 @@
+package kaddons
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/blesswinsamuel/kgen"
+)
+
+type deferredHelmChart struct {
+	scope        kgen.Scope
+	props        HelmChartProps
+	templateOpts helmTemplateOptions
+}
+
+// deferredHelmCharts holds the charts registered by AddHelmChart when Options.DeferHelmCharts is set.
+type deferredHelmCharts struct {
+	mu     sync.Mutex
+	charts []deferredHelmChart
+}
+
+var deferredHelmChartsContextKey = kgen.GenerateContextKey()
+
+// deferringScope is implemented by the scopes of kgen builders. Its methods aren't part of kgen.Scope, as they are only needed to defer helm charts.
+type deferringScope interface {
+	kgen.Scope
+	Root() kgen.Scope
+	Placeholder() kgen.Scope
+	OnRenderManifests(fn func() error)
+}
+
+func asDeferringScope(scope kgen.Scope) deferringScope {
+	s, ok := scope.(deferringScope)
+	if !ok {
+		scope.Logger().Panicf("helm charts can't be deferred in scope '%s' of type %T: it isn't created by a kgen builder", scope.ID(), scope)
+	}
+	return s
+}
+
+// getDeferredHelmCharts returns the deferred charts of the builder, which are kept in the root scope so that scopes with their own options share them.
+func getDeferredHelmCharts(scope kgen.Scope) *deferredHelmCharts {
+	root := asDeferringScope(asDeferringScope(scope).Root())
+	if d, ok := root.GetContext(deferredHelmChartsContextKey).(*deferredHelmCharts); ok {
+		return d
+	}
+	d := &deferredHelmCharts{}
+	root.SetContext(deferredHelmChartsContextKey, d)
+	root.OnRenderManifests(func() error {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		if len(d.charts) > 0 {
+			return fmt.Errorf("%d deferred helm chart(s) were not rendered: call kaddons.RenderHelmCharts before RenderManifests", len(d.charts))
+		}
+		return nil
+	})
+	return d
+}
+
+func (d *deferredHelmCharts) add(chart deferredHelmChart) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.charts = append(d.charts, chart)
+}
+
+func (d *deferredHelmCharts) take() []deferredHelmChart {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	charts := d.charts
+	d.charts = nil
+	return charts
+}
+
+// RenderHelmCharts fetches and templates the charts deferred by AddHelmChart (see Options.DeferHelmCharts) concurrently,
+// with up to Options.HelmConcurrency charts at a time. The objects are then added to their scopes at the position AddHelmChart was called.
+// It renders the charts deferred in all the scopes of the builder and must be called before RenderManifests.
+func RenderHelmCharts(scope kgen.Scope) {
+	opts := getAddonsConfig(scope)
+	concurrency := opts.HelmConcurrency
+	if concurrency <= 0 {
+		concurrency = runtime.NumCPU()
+	}
+	charts := getDeferredHelmCharts(scope).take()
+	results := make([][]helmObject, len(charts))
+	errs := make([]error, len(charts))
+	semaphore := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, chart := range charts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+			objects, err := execHelmTemplateAndGetObjects(chart.templateOpts)
+			if err != nil {
+				err = fmt.Errorf("release '%s' in scope '%s': %w", chart.props.ReleaseName, strings.Join(chart.scope.Path(), "/"), err)
+			}
+			results[i], errs[i] = objects, err
+		}()
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		scope.Logger().Panicf("failed to execute helm template: %v", err)
+	}
+	for i, chart := range charts {
+		addHelmChartObjects(chart.scope, chart.props, results[i])
+	}
+}
+
+// helmChartPathLocks holds a mutex per cached chart path, so that the same chart is not fetched concurrently.
+var helmChartPathLocks sync.Map
+
+func lockHelmChartPath(chartPath string) func() {
+	mu, _ := helmChartPathLocks.LoadOrStore(chartPath, &sync.Mutex{})
+	mu.(*sync.Mutex).Lock()
+	return mu.(*sync.Mutex).Unlock
+}
@@ -0,0 +1,60 @@
+package kaddons
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/blesswinsamuel/kgen"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+)
+
+const testChartPath = "testdata/charts/demo"
+
+func newTestBuilder() kgen.Builder {
+	return kgen.NewBuilder(kgen.BuilderOptions{SchemeBuilder: runtime.SchemeBuilder{clientgoscheme.AddToScheme}})
+}
+
+func objectNames(scope kgen.Scope) []string {
+	names := []string{}
+	_ = scope.WalkApiObjects(func(object kgen.ApiObject) error {
+		names = append(names, object.GetKind()+"/"+object.GetName())
+		return nil
+	})
+	return names
+}
+
+func TestRenderHelmChartsKeepsPosition(t *testing.T) {
+	builder := newTestBuilder()
+	cacheDir := t.TempDir()
+	// SetOptions on sibling scopes still shares the deferred charts of the builder
+	for _, id := range []string{"a", "b"} {
+		scope := builder.CreateScope(id, kgen.ScopeProps{Namespace: id})
+		SetOptions(scope, Options{CacheDir: cacheDir, HelmEngine: HelmEngineSDK, DeferHelmCharts: true})
+		scope.AddApiObjectFromMap(map[string]any{"apiVersion": "v1", "kind": "ConfigMap", "metadata": map[string]any{"name": "before"}})
+		AddHelmChart(scope, HelmChartProps{ChartPath: testChartPath, ReleaseName: id})
+		scope.AddApiObjectFromMap(map[string]any{"apiVersion": "v1", "kind": "ConfigMap", "metadata": map[string]any{"name": "after"}})
+	}
+	RenderHelmCharts(builder)
+	want := []string{
+		"ConfigMap/before", "CustomResourceDefinition/widgets.example.com", "ConfigMap/a-config", "ConfigMap/after",
+		"ConfigMap/before", "CustomResourceDefinition/widgets.example.com", "ConfigMap/b-config", "ConfigMap/after",
+	}
+	if got := objectNames(builder); !slices.Equal(got, want) {
+		t.Errorf("objects = %v, want %v", got, want)
+	}
+	builder.RenderManifests(kgen.RenderManifestsOptions{Outdir: t.TempDir()})
+}
+
+func TestRenderManifestsPanicsOnPendingHelmCharts(t *testing.T) {
+	builder := newTestBuilder()
+	scope := builder.CreateScope("app", kgen.ScopeProps{Namespace: "app"})
+	SetOptions(scope, Options{CacheDir: t.TempDir(), HelmEngine: HelmEngineSDK, DeferHelmCharts: true})
+	AddHelmChart(scope, HelmChartProps{ChartPath: testChartPath, ReleaseName: "app"})
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("expected RenderManifests to panic on charts not rendered by RenderHelmCharts")
+		}
+	}()
+	builder.RenderManifests(kgen.RenderManifestsOptions{Outdir: t.TempDir()})
+}
@@ -0,0 +1,186 @@
+package kaddons
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/blesswinsamuel/kgen"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// resolveHelmChartDependencies returns the path of the chart with its dependencies, building the missing ones (as helm dependency build does)
+// into a copy of the chart in the cache. The chart path is returned as is if it has no missing dependencies.
+func resolveHelmChartDependencies(runner helmRunner, props helmTemplateOptions, chartPath string) (string, error) {
+	chrt, err := loader.Load(chartPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to load chart: %w", err)
+	}
+	if len(chrt.Metadata.Dependencies) == 0 || action.CheckDependencies(chrt, chrt.Metadata.Dependencies) == nil {
+		return chartPath, nil
+	}
+	chartDigest, err := helmChartDigest(chartPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to compute chart digest: %w", err)
+	}
+	// the resolved chart is keyed by the digest of the chart, so that it is rebuilt when the chart changes
+	depsDir := path.Join(props.CacheDir, "deps", strings.TrimPrefix(chartDigest, "sha256:"))
+	resolvedChartPath := path.Join(depsDir, chrt.Name())
+	unlock := lockHelmChartPath(depsDir)
+	defer unlock()
+	if props.LockFile != "" && props.UpdateLockFile && !props.Offline {
+		// build the dependencies again to refresh their digests
+		if err := os.RemoveAll(depsDir); err != nil {
+			return "", fmt.Errorf("failed to remove cached chart dependencies: %w", err)
+		}
+	}
+	if _, err := os.Stat(depsDir); err == nil {
+		return resolvedChartPath, verifyHelmDependencyDigests(props, chrt, resolvedChartPath)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("error occured while checking if chart dependencies exist in cache: %w", err)
+	}
+	if props.Offline {
+		return "", fmt.Errorf("dependencies of chart '%s' are not in the cache (%s) and offline mode is enabled; populate the cache with PrefetchHelmCharts", chrt.Name(), depsDir)
+	}
+	props.Logger.Infof("Building dependencies of chart '%s'...", chrt.Name())
+	if err := os.MkdirAll(path.Dir(depsDir), os.ModePerm); err != nil {
+		return "", fmt.Errorf("MkdirAll failed: %w", err)
+	}
+	// build in a temporary directory first, so that an interrupted run doesn't leave partial dependencies
+	tmpDir, err := os.MkdirTemp(path.Dir(depsDir), "tmp-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	if info, err := os.Stat(chartPath); err != nil {
+		return "", err
+	} else if info.IsDir() {
+		err = os.CopyFS(filepath.Join(tmpDir, chrt.Name()), os.DirFS(chartPath))
+	} else {
+		err = chartutil.ExpandFile(tmpDir, chartPath)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to unpack chart: %w", err)
+	}
+	if err := runner.dependencyBuild(props, filepath.Join(tmpDir, chrt.Name())); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmpDir, depsDir); err != nil {
+		return "", fmt.Errorf("failed to move chart dependencies into the cache: %w", err)
+	}
+	return resolvedChartPath, verifyHelmDependencyDigests(props, chrt, resolvedChartPath)
+}
+
+// verifyHelmDependencyDigests checks the digests of the dependency tarballs built into the resolved chart against the lockfile (see verifyHelmChartDigest).
+// Dependencies shipped with the chart and local (file://) dependencies are part of the chart, and are not recorded.
+func verifyHelmDependencyDigests(props helmTemplateOptions, chrt *chart.Chart, resolvedChartPath string) error {
+	if props.LockFile == "" {
+		return nil
+	}
+	shipped := map[string]bool{}
+	for _, dependency := range chrt.Dependencies() {
+		shipped[dependency.Name()] = true
+	}
+	tarballs, err := filepath.Glob(filepath.Join(resolvedChartPath, "charts", "*.tgz"))
+	if err != nil {
+		return err
+	}
+	for _, tarball := range tarballs {
+		dependencyChart, err := loader.Load(tarball)
+		if err != nil {
+			return fmt.Errorf("failed to load dependency '%s': %w", filepath.Base(tarball), err)
+		}
+		if shipped[dependencyChart.Name()] {
+			continue
+		}
+		i := slices.IndexFunc(chrt.Metadata.Dependencies, func(dependency *chart.Dependency) bool { return dependency.Name == dependencyChart.Name() })
+		if i == -1 || strings.HasPrefix(chrt.Metadata.Dependencies[i].Repository, "file://") {
+			continue
+		}
+		chartInfo := HelmChartInfo{Repo: chrt.Metadata.Dependencies[i].Repository, Chart: dependencyChart.Name(), Version: dependencyChart.Metadata.Version}
+		if err := verifyHelmChartDigest(props.LockFile, props.UpdateLockFile, chartInfo, tarball); err != nil {
+			return fmt.Errorf("dependency of chart '%s': %w", chrt.Name(), err)
+		}
+	}
+	return nil
+}
+
+// helmObject is an object templated by helm, along with the path of the template it was generated from (e.g. "chart/templates/deployment.yaml").
+type helmObject struct {
+	object runtime.Object
+	source string
+}
+
+var helmSourceRegexp = regexp.MustCompile(`(?m)^# Source: (.+)$`)
+
+// decodeHelmObjects decodes the output of helm template, keeping track of the "# Source:" comment of each document.
+func decodeHelmObjects(out []byte) ([]helmObject, error) {
+	reader := yaml.NewYAMLReader(bufio.NewReader(bytes.NewReader(out)))
+	objects := []helmObject{}
+	for {
+		document, err := reader.Read()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, fmt.Errorf("error decoding yaml: %w", err)
+		}
+		source := ""
+		if match := helmSourceRegexp.FindSubmatch(document); match != nil {
+			source = strings.TrimSpace(string(match[1]))
+		}
+		// documents are added as helm template outputs them (unlike decodeObjects, List objects are not split)
+		object, err := decodeDocument(document)
+		if err != nil {
+			return nil, err
+		}
+		if object != nil {
+			objects = append(objects, helmObject{object: object, source: source})
+		}
+	}
+	return objects, nil
+}
+
+// helmTemplateSource splits the path of a template into the names of the (nested) subcharts it belongs to and its path in the (sub)chart,
+// e.g. ["postgresql", "common"] and "templates/secret.yaml" for "app/charts/postgresql/charts/common/templates/secret.yaml".
+func helmTemplateSource(source string) ([]string, string) {
+	subcharts := []string{}
+	parts := strings.Split(source, "/")
+	i := 1
+	for ; i+1 < len(parts) && parts[i] == "charts"; i += 2 {
+		subcharts = append(subcharts, parts[i+1])
+	}
+	return subcharts, strings.Join(parts[min(i, len(parts)):], "/")
+}
+
+// helmSourceScopeID returns the ID of the scope for the objects of a template, e.g. "deployment" for "templates/deployment.yaml"
+// and "crds-widgets" for "crds/widgets.yaml".
+func helmSourceScopeID(template string) string {
+	template = strings.TrimPrefix(template, "templates/")
+	template = strings.TrimSuffix(template, path.Ext(template))
+	return strings.ReplaceAll(template, "/", "-")
+}
+
+// helmScopes creates the child scopes the objects of a helm chart are placed in, on first use.
+type helmScopes map[string]kgen.Scope
+
+func (scopes helmScopes) child(parent kgen.Scope, id string) kgen.Scope {
+	key := strings.Join(append(parent.Path(), id), "/")
+	if _, ok := scopes[key]; !ok {
+		scopes[key] = parent.CreateScope(id, kgen.ScopeProps{})
+	}
+	return scopes[key]
+}
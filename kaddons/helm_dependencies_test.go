@@ -0,0 +1,126 @@
+package kaddons
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/repo"
+)
+
+// setTestHelmHome points the helm configuration and cache to a temporary directory.
+func setTestHelmHome(t *testing.T) {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HELM_CACHE_HOME", filepath.Join(home, "cache"))
+	t.Setenv("HELM_CONFIG_HOME", filepath.Join(home, "config"))
+	t.Setenv("HELM_DATA_HOME", filepath.Join(home, "data"))
+	t.Setenv("HELM_REPOSITORY_CONFIG", filepath.Join(home, "config", "repositories.yaml"))
+	t.Setenv("HELM_REPOSITORY_CACHE", filepath.Join(home, "cache", "repository"))
+}
+
+// newTestHelmRepo serves a chart repository with the test chart.
+func newTestHelmRepo(t *testing.T) string {
+	t.Helper()
+	repoDir := t.TempDir()
+	chrt, err := loader.Load(testChartPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := chartutil.Save(chrt, repoDir); err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.FileServer(http.Dir(repoDir)))
+	t.Cleanup(server.Close)
+	index, err := repo.IndexDirectory(repoDir, server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := index.WriteFile(filepath.Join(repoDir, "index.yaml"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return server.URL
+}
+
+// newTestParentChart creates a chart depending on the test chart in the given repository.
+func newTestParentChart(t *testing.T, repoURL string) string {
+	t.Helper()
+	chartDir := filepath.Join(t.TempDir(), "parent")
+	if err := os.MkdirAll(filepath.Join(chartDir, "templates"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	chartYaml := "apiVersion: v2\nname: parent\nversion: 0.2.0\ndependencies:\n  - name: demo\n    version: 0.1.0\n    repository: " + repoURL + "\n"
+	if err := os.WriteFile(filepath.Join(chartDir, "Chart.yaml"), []byte(chartYaml), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return chartDir
+}
+
+func TestHelmDependenciesLockFile(t *testing.T) {
+	setTestHelmHome(t)
+	repoURL := newTestHelmRepo(t)
+	lockFile := filepath.Join(t.TempDir(), "kgen.lock")
+	props := helmTemplateOptions{
+		ChartPath:       newTestParentChart(t, repoURL),
+		ReleaseName:     "app",
+		Namespace:       "app",
+		CacheDir:        filepath.Join(t.TempDir(), "helm-charts"),
+		HelmKubeVersion: "v1.30.2",
+		HelmEngine:      HelmEngineSDK,
+		LockFile:        lockFile,
+		Logger:          newTestBuilder().Logger(),
+	}
+	if _, err := execHelmTemplateAndGetObjects(props); err != nil {
+		t.Fatalf("execHelmTemplateAndGetObjects: %v", err)
+	}
+	lock, err := readHelmLockFile(lockFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lock.Charts) != 1 || lock.Charts[0].Repo != repoURL || lock.Charts[0].Chart != "demo" || lock.Charts[0].Version != "0.1.0" {
+		t.Fatalf("lockfile charts = %+v, want the demo dependency", lock.Charts)
+	}
+
+	// the dependencies in the cache are verified too
+	lock.Charts[0].Digest = "sha256:0000"
+	if err := writeHelmLockFile(lockFile, lock); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := execHelmTemplateAndGetObjects(props); err == nil || !strings.Contains(err.Error(), "doesn't match the digest in lockfile") {
+		t.Fatalf("expected a digest mismatch error, got %v", err)
+	}
+
+	props.UpdateLockFile = true
+	if _, err := execHelmTemplateAndGetObjects(props); err != nil {
+		t.Fatalf("execHelmTemplateAndGetObjects with UpdateLockFile: %v", err)
+	}
+	if lock, err := readHelmLockFile(lockFile); err != nil || lock.Charts[0].Digest == "sha256:0000" {
+		t.Errorf("expected the digest to be updated, got %+v (%v)", lock, err)
+	}
+}
+
+func TestHelmTemplateSource(t *testing.T) {
+	tests := []struct {
+		source        string
+		wantSubcharts []string
+		wantTemplate  string
+	}{
+		{source: "app/templates/deployment.yaml", wantSubcharts: []string{}, wantTemplate: "templates/deployment.yaml"},
+		{source: "app/crds/widgets.yaml", wantSubcharts: []string{}, wantTemplate: "crds/widgets.yaml"},
+		{source: "app/charts/postgresql/templates/primary/statefulset.yaml", wantSubcharts: []string{"postgresql"}, wantTemplate: "templates/primary/statefulset.yaml"},
+		{source: "app/charts/postgresql/charts/common/templates/secret.yaml", wantSubcharts: []string{"postgresql", "common"}, wantTemplate: "templates/secret.yaml"},
+		{source: "", wantSubcharts: []string{}, wantTemplate: ""},
+	}
+	for _, tt := range tests {
+		subcharts, template := helmTemplateSource(tt.source)
+		if !slices.Equal(subcharts, tt.wantSubcharts) || template != tt.wantTemplate {
+			t.Errorf("helmTemplateSource(%q) = %v, %q, want %v, %q", tt.source, subcharts, template, tt.wantSubcharts, tt.wantTemplate)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package kaddons
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/blesswinsamuel/kgen"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+type helmHooksMode string
+
+const (
+	// HelmHooksArgoCD translates helm hooks into Argo CD resource hooks (argocd.argoproj.io/hook), with the hook weight as the sync wave.
+	// pre-install and pre-upgrade hooks become PreSync hooks, post-install and post-upgrade hooks become PostSync hooks, and post-delete hooks become PostDelete hooks.
+	HelmHooksArgoCD helmHooksMode = "argocd"
+	// HelmHooksKapp translates helm hooks into kapp change groups and change rules, so that pre-install and pre-upgrade hooks are applied
+	// before the other objects of the release, and post-install and post-upgrade hooks after them, in the order of their weights.
+	// Hook Jobs and Pods get a kapp nonce, so that they run again on every deploy like helm hooks do.
+	HelmHooksKapp helmHooksMode = "kapp"
+)
+
+const (
+	helmHookAnnotation             = "helm.sh/hook"
+	helmHookWeightAnnotation       = "helm.sh/hook-weight"
+	helmHookDeletePolicyAnnotation = "helm.sh/hook-delete-policy"
+)
+
+var argoCDHookTypes = map[string]string{
+	"pre-install":  "PreSync",
+	"pre-upgrade":  "PreSync",
+	"post-install": "PostSync",
+	"post-upgrade": "PostSync",
+	"post-delete":  "PostDelete",
+}
+
+var argoCDHookDeletePolicies = map[string]string{
+	"before-hook-creation": "BeforeHookCreation",
+	"hook-succeeded":       "HookSucceeded",
+	"hook-failed":          "HookFailed",
+}
+
+type helmHook struct {
+	object runtime.Object
+	meta   metav1.Object
+	events []string
+	weight int
+}
+
+// translateHelmHooks translates the helm hook annotations of the templated objects into the annotations of the deploy tool selected by mode.
+// Hooks that can't be translated are dropped with a warning. Objects are returned in their original order.
+func translateHelmHooks(scope kgen.Scope, releaseName string, mode helmHooksMode, objects []helmObject) []helmObject {
+	hooks := []helmHook{}
+	releaseObjects := []metav1.Object{}
+	for _, object := range objects {
+		object := object.object
+		accessor, err := meta.Accessor(object)
+		if err != nil {
+			scope.Logger().Panicf("failed to access object metadata: %v", err)
+		}
+		annotations := accessor.GetAnnotations()
+		if _, ok := annotations[helmHookAnnotation]; !ok {
+			// helm installs CRDs before running any hook
+			if object.GetObjectKind().GroupVersionKind().GroupKind() != (schema.GroupKind{Group: "apiextensions.k8s.io", Kind: "CustomResourceDefinition"}) {
+				releaseObjects = append(releaseObjects, accessor)
+			}
+			continue
+		}
+		hook := helmHook{object: object, meta: accessor}
+		for _, event := range strings.Split(annotations[helmHookAnnotation], ",") {
+			hook.events = append(hook.events, strings.TrimSpace(event))
+		}
+		if weight, ok := annotations[helmHookWeightAnnotation]; ok {
+			hook.weight, err = strconv.Atoi(strings.TrimSpace(weight))
+			if err != nil {
+				scope.Logger().Panicf("invalid hook weight '%s' of '%s': %v", weight, accessor.GetName(), err)
+			}
+		}
+		hooks = append(hooks, hook)
+	}
+
+	dropped := map[runtime.Object]bool{}
+	switch mode {
+	case HelmHooksArgoCD:
+		for _, hook := range hooks {
+			if !translateArgoCDHook(hook) {
+				scope.Logger().Warnf("dropping helm hook '%s' of release '%s': hook events '%s' are not supported by Argo CD", hook.meta.GetName(), releaseName, strings.Join(hook.events, ","))
+				dropped[hook.object] = true
+			}
+		}
+	case HelmHooksKapp:
+		for _, hook := range translateKappHooks(releaseName, hooks, releaseObjects) {
+			scope.Logger().Warnf("dropping helm hook '%s' of release '%s': hook events '%s' are not supported by kapp", hook.meta.GetName(), releaseName, strings.Join(hook.events, ","))
+			dropped[hook.object] = true
+		}
+	default:
+		scope.Logger().Panicf("unknown helm hooks mode '%s'", mode)
+	}
+	return slices.DeleteFunc(objects, func(object helmObject) bool { return dropped[object.object] })
+}
+
+func removeHelmHookAnnotations(annotations map[string]string) {
+	delete(annotations, helmHookAnnotation)
+	delete(annotations, helmHookWeightAnnotation)
+	delete(annotations, helmHookDeletePolicyAnnotation)
+}
+
+// translateArgoCDHook replaces the helm hook annotations of the hook with Argo CD ones. It returns false if none of the hook events are supported.
+func translateArgoCDHook(hook helmHook) bool {
+	hookTypes := []string{}
+	for _, event := range hook.events {
+		if hookType, ok := argoCDHookTypes[event]; ok && !slices.Contains(hookTypes, hookType) {
+			hookTypes = append(hookTypes, hookType)
+		}
+	}
+	if len(hookTypes) == 0 {
+		return false
+	}
+	annotations := hook.meta.GetAnnotations()
+	deletePolicies := []string{}
+	for _, policy := range strings.Split(annotations[helmHookDeletePolicyAnnotation], ",") {
+		if deletePolicy, ok := argoCDHookDeletePolicies[strings.TrimSpace(policy)]; ok {
+			deletePolicies = append(deletePolicies, deletePolicy)
+		}
+	}
+	removeHelmHookAnnotations(annotations)
+	annotations["argocd.argoproj.io/hook"] = strings.Join(hookTypes, ",")
+	annotations["argocd.argoproj.io/sync-wave"] = strconv.Itoa(hook.weight)
+	if len(deletePolicies) > 0 {
+		annotations["argocd.argoproj.io/hook-delete-policy"] = strings.Join(deletePolicies, ",")
+	}
+	hook.meta.SetAnnotations(annotations)
+	return true
+}
+
+// translateKappHooks chains the pre hooks, the release objects and the post hooks with kapp change groups and change rules,
+// ordering hooks of the same phase by weight. It returns the hooks that have no pre or post install/upgrade event.
+func translateKappHooks(releaseName string, hooks []helmHook, releaseObjects []metav1.Object) []helmHook {
+	preHooks, postHooks, unsupported := []helmHook{}, []helmHook{}, []helmHook{}
+	for _, hook := range hooks {
+		switch {
+		case slices.Contains(hook.events, "pre-install") || slices.Contains(hook.events, "pre-upgrade"):
+			preHooks = append(preHooks, hook)
+		case slices.Contains(hook.events, "post-install") || slices.Contains(hook.events, "post-upgrade"):
+			postHooks = append(postHooks, hook)
+		default:
+			unsupported = append(unsupported, hook)
+		}
+	}
+	if len(preHooks) == 0 && len(postHooks) == 0 {
+		return unsupported
+	}
+
+	groupPrefix := fmt.Sprintf("kgen.helm/%s", releaseName)
+	setChangeAnnotations := func(object metav1.Object, group string, after string) {
+		annotations := object.GetAnnotations()
+		if annotations == nil {
+			annotations = map[string]string{}
+		}
+		annotations["kapp.k14s.io/change-group"] = group
+		if after != "" {
+			annotations["kapp.k14s.io/change-rule"] = "upsert after upserting " + after
+		}
+		object.SetAnnotations(annotations)
+	}
+	// chainHooks assigns a change group per weight, each depending on the previous one, and returns the last group.
+	chainHooks := func(phase string, hooks []helmHook, after string) string {
+		slices.SortStableFunc(hooks, func(a, b helmHook) int { return a.weight - b.weight })
+		for i, hook := range hooks {
+			group := fmt.Sprintf("%s.%s.%d", groupPrefix, phase, hook.weight)
+			if i > 0 && hooks[i-1].weight != hook.weight {
+				after = fmt.Sprintf("%s.%s.%d", groupPrefix, phase, hooks[i-1].weight)
+			}
+			annotations := hook.meta.GetAnnotations()
+			removeHelmHookAnnotations(annotations)
+			switch hook.object.GetObjectKind().GroupVersionKind().Kind {
+			case "Job", "Pod":
+				annotations["kapp.k14s.io/nonce"] = ""
+				annotations["kapp.k14s.io/update-strategy"] = "fallback-on-replace"
+			}
+			hook.meta.SetAnnotations(annotations)
+			setChangeAnnotations(hook.meta, group, after)
+			if i == len(hooks)-1 {
+				return group
+			}
+		}
+		return after
+	}
+
+	releaseGroup := groupPrefix + ".release"
+	after := chainHooks("pre", preHooks, "")
+	for _, object := range releaseObjects {
+		setChangeAnnotations(object, releaseGroup, after)
+	}
+	chainHooks("post", postHooks, releaseGroup)
+	return unsupported
+}
@@ -0,0 +1,52 @@
+package kaddons
+
+import (
+	"maps"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newTestHook(kind string, name string, annotations map[string]any) helmObject {
+	object := newTestObject("v1", kind, "app", name, nil)
+	if annotations != nil {
+		object.Object["metadata"].(map[string]any)["annotations"] = annotations
+	}
+	return helmObject{object: object}
+}
+
+func TestTranslateKappHooks(t *testing.T) {
+	objects := []helmObject{
+		newTestHook("ConfigMap", "config", nil),
+		newTestHook("Job", "migrate", map[string]any{"helm.sh/hook": "pre-install,pre-upgrade", "helm.sh/hook-weight": "5"}),
+		newTestHook("Secret", "bootstrap", map[string]any{"helm.sh/hook": "pre-install", "helm.sh/hook-weight": "-5", "helm.sh/hook-delete-policy": "before-hook-creation"}),
+		newTestHook("Job", "notify", map[string]any{"helm.sh/hook": "post-install"}),
+		newTestHook("Pod", "cleanup", map[string]any{"helm.sh/hook": "post-delete"}),
+	}
+	objects = append(objects, helmObject{object: newTestObject("apiextensions.k8s.io/v1", "CustomResourceDefinition", "", "widgets.example.com", nil)})
+	objects = translateHelmHooks(newTestBuilder(), "app", HelmHooksKapp, objects)
+
+	want := map[string]map[string]string{
+		"config":    {"kapp.k14s.io/change-group": "kgen.helm/app.release", "kapp.k14s.io/change-rule": "upsert after upserting kgen.helm/app.pre.5"},
+		"bootstrap": {"kapp.k14s.io/change-group": "kgen.helm/app.pre.-5"},
+		"migrate": {
+			"kapp.k14s.io/change-group": "kgen.helm/app.pre.5", "kapp.k14s.io/change-rule": "upsert after upserting kgen.helm/app.pre.-5",
+			"kapp.k14s.io/nonce": "", "kapp.k14s.io/update-strategy": "fallback-on-replace",
+		},
+		"notify": {
+			"kapp.k14s.io/change-group": "kgen.helm/app.post.0", "kapp.k14s.io/change-rule": "upsert after upserting kgen.helm/app.release",
+			"kapp.k14s.io/nonce": "", "kapp.k14s.io/update-strategy": "fallback-on-replace",
+		},
+		// CRDs are applied before the hooks, as helm does
+		"widgets.example.com": nil,
+	}
+	if len(objects) != len(want) {
+		t.Fatalf("got %d objects, want %d (the post-delete hook is dropped)", len(objects), len(want))
+	}
+	for _, object := range objects {
+		accessor := object.object.(metav1.Object)
+		if got := accessor.GetAnnotations(); !maps.Equal(got, want[accessor.GetName()]) {
+			t.Errorf("annotations of '%s' = %v, want %v", accessor.GetName(), got, want[accessor.GetName()])
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package kaddons
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"runtime/debug"
+	"slices"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/cli"
+	"helm.sh/helm/v3/pkg/cli/values"
+	"helm.sh/helm/v3/pkg/downloader"
+	"helm.sh/helm/v3/pkg/getter"
+	"helm.sh/helm/v3/pkg/postrender"
+	"helm.sh/helm/v3/pkg/registry"
+	"helm.sh/helm/v3/pkg/release"
+)
+
+// helmSDK renders charts in-process with the Helm Go SDK, mirroring what the helm pull and helm template commands do.
+type helmSDK struct{}
+
+func newHelmActionConfig(settings *cli.EnvSettings, plainHTTP bool) (*action.Configuration, error) {
+	registryOpts := []registry.ClientOption{
+		registry.ClientOptEnableCache(true),
+		registry.ClientOptCredentialsFile(settings.RegistryConfig),
+	}
+	if plainHTTP {
+		registryOpts = append(registryOpts, registry.ClientOptPlainHTTP())
+	}
+	registryClient, err := registry.NewClient(registryOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create registry client: %w", err)
+	}
+	return &action.Configuration{
+		RegistryClient: registryClient,
+		Log:            func(string, ...interface{}) {},
+	}, nil
+}
+
+func (helmSDK) pull(props helmTemplateOptions, destination string) error {
+	settings := cli.New()
+	cfg, err := newHelmActionConfig(settings, props.ChartInfo.PlainHTTP)
+	if err != nil {
+		return err
+	}
+	pull := action.NewPullWithOpts(action.WithConfig(cfg))
+	pull.Settings = settings
+	if !props.ChartInfo.isOCI() {
+		pull.RepoURL = props.ChartInfo.Repo
+	}
+	pull.PlainHTTP = props.ChartInfo.PlainHTTP
+	pull.Version = props.ChartInfo.Version
+	pull.DestDir = destination
+	if out, err := pull.Run(props.ChartInfo.chartRef()); err != nil {
+		return fmt.Errorf("helm pull failed: %w", err)
+	} else if out != "" {
+		fmt.Println(out)
+		props.Logger.Warnf("Received unexpected output from helm pull for chart '%s'", props.ChartInfo.Chart)
+	}
+	return nil
+}
+
+func (helmSDK) dependencyBuild(props helmTemplateOptions, chartDir string) error {
+	settings := cli.New()
+	cfg, err := newHelmActionConfig(settings, props.ChartInfo.PlainHTTP)
+	if err != nil {
+		return err
+	}
+	manager := &downloader.Manager{
+		Out:              io.Discard,
+		ChartPath:        chartDir,
+		Getters:          getter.All(settings),
+		RegistryClient:   cfg.RegistryClient,
+		RepositoryConfig: settings.RepositoryConfig,
+		RepositoryCache:  settings.RepositoryCache,
+	}
+	if err := manager.Build(); err != nil {
+		return fmt.Errorf("helm dependency build failed: %w", err)
+	}
+	return nil
+}
+
+func (helmSDK) version() (string, error) {
+	buildInfo, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "", errors.New("failed to read build info for the helm SDK version")
+	}
+	for _, module := range buildInfo.Deps {
+		if module.Path == "helm.sh/helm/v3" {
+			if module.Replace != nil {
+				module = module.Replace
+			}
+			return module.Path + "@" + module.Version, nil
+		}
+	}
+	return "", errors.New("helm SDK module not found in build info")
+}
+
+func (helmSDK) template(props helmTemplateOptions, chartPath string, valuesJson []byte) ([]byte, error) {
+	settings := cli.New()
+	cfg, err := newHelmActionConfig(settings, false)
+	if err != nil {
+		return nil, err
+	}
+	install := action.NewInstall(cfg)
+	install.DryRun = true
+	install.DryRunOption = "true"
+	install.ClientOnly = true
+	install.Replace = true
+	install.ReleaseName = props.ReleaseName
+	install.Namespace = props.Namespace
+	install.IncludeCRDs = !props.SkipCRDs
+	install.DisableHooks = !props.IncludeHooks
+	install.APIVersions = chartutil.VersionSet(props.APIVersions)
+	if props.PostRenderer != "" {
+		postRenderer, err := postrender.NewExec(props.PostRenderer, props.PostRendererArgs...)
+		if err != nil {
+			return nil, fmt.Errorf("invalid post renderer: %w", err)
+		}
+		install.PostRenderer = postRenderer
+	}
+	kubeVersion, err := chartutil.ParseKubeVersion(props.HelmKubeVersion)
+	if err != nil {
+		return nil, fmt.Errorf("invalid kube version '%s': %w", props.HelmKubeVersion, err)
+	}
+	install.KubeVersion = kubeVersion
+
+	chrt, err := loader.Load(chartPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load chart: %w", err)
+	}
+	switch chrt.Metadata.Type {
+	case "", "application":
+	default:
+		return nil, fmt.Errorf("%s charts are not installable", chrt.Metadata.Type)
+	}
+	if req := chrt.Metadata.Dependencies; req != nil {
+		if err := action.CheckDependencies(chrt, req); err != nil {
+			return nil, fmt.Errorf("chart dependencies check failed: %w", err)
+		}
+	}
+	values, err := mergeHelmValues(settings, props, valuesJson)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read values: %w", err)
+	}
+	rel, err := install.RunWithContext(context.Background(), chrt, values)
+	if err != nil {
+		return nil, fmt.Errorf("helm template failed: %w", err)
+	}
+	var manifests strings.Builder
+	fmt.Fprintln(&manifests, strings.TrimSpace(rel.Manifest))
+	if props.IncludeHooks {
+		for _, hook := range rel.Hooks {
+			if !props.IncludeTests && slices.Contains(hook.Events, release.HookTest) {
+				continue
+			}
+			fmt.Fprintf(&manifests, "---\n# Source: %s\n%s\n", hook.Path, hook.Manifest)
+		}
+	}
+	return []byte(manifests.String()), nil
+}
+
+// mergeHelmValues merges the values the same way helm template does: values files in order, then the values json
+// (passed to the helm binary as the last values file), then --set-string and --set-file.
+func mergeHelmValues(settings *cli.EnvSettings, props helmTemplateOptions, valuesJson []byte) (map[string]interface{}, error) {
+	valuesFile, err := os.CreateTemp("", "kgen-helm-values-*.json")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(valuesFile.Name())
+	if _, err := valuesFile.Write(valuesJson); err != nil {
+		valuesFile.Close()
+		return nil, err
+	}
+	if err := valuesFile.Close(); err != nil {
+		return nil, err
+	}
+	valueOpts := values.Options{
+		ValueFiles:   append(slices.Clone(props.ValuesFiles), valuesFile.Name()),
+		StringValues: helmSetValues(props.SetString),
+		FileValues:   helmSetValues(props.SetFile),
+	}
+	return valueOpts.MergeValues(getter.All(settings))
+}
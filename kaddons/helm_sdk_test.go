@@ -0,0 +1,51 @@
+package kaddons
+
+import (
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestHelmEnginesRenderTheSameObjects(t *testing.T) {
+	if _, err := exec.LookPath("helm"); err != nil {
+		t.Skip("helm not found in PATH")
+	}
+	setTestHelmHome(t)
+	tests := []struct {
+		name        string
+		props       helmTemplateOptions
+		wantObjects int
+	}{
+		{name: "defaults", wantObjects: 2},
+		{name: "skip crds", props: helmTemplateOptions{SkipCRDs: true}, wantObjects: 1},
+		{name: "hooks and tests", props: helmTemplateOptions{IncludeHooks: true, IncludeTests: true}, wantObjects: 4},
+		{name: "api versions", props: helmTemplateOptions{APIVersions: []string{"example.com/v1/Widget"}, Values: map[string]any{"message": "hi"}}, wantObjects: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rendered := map[helmEngine][]helmObject{}
+			for _, engine := range []helmEngine{HelmEngineCLI, HelmEngineSDK} {
+				props := tt.props
+				props.ChartPath = testChartPath
+				props.ReleaseName = "app"
+				props.Namespace = "app"
+				props.CacheDir = filepath.Join(t.TempDir(), "helm-charts")
+				props.HelmKubeVersion = "v1.30.2"
+				props.HelmEngine = engine
+				props.Logger = newTestBuilder().Logger()
+				objects, err := execHelmTemplateAndGetObjects(props)
+				if err != nil {
+					t.Fatalf("%s: %v", engine, err)
+				}
+				rendered[engine] = objects
+			}
+			if len(rendered[HelmEngineSDK]) != tt.wantObjects {
+				t.Errorf("got %d objects, want %d", len(rendered[HelmEngineSDK]), tt.wantObjects)
+			}
+			if !reflect.DeepEqual(rendered[HelmEngineCLI], rendered[HelmEngineSDK]) {
+				t.Errorf("objects rendered by the engines differ:\ncli: %v\nsdk: %v", rendered[HelmEngineCLI], rendered[HelmEngineSDK])
+			}
+		})
+	}
+}
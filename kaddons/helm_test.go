@@ -0,0 +1,85 @@
+package kaddons
+
+import (
+	"io"
+	"log"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/blesswinsamuel/kgen"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	helmregistry "helm.sh/helm/v3/pkg/registry"
+)
+
+func TestHelmSetValues(t *testing.T) {
+	got := helmSetValues(map[string]string{
+		"image.tag":   "1.0",
+		"annotations": "a=b,c=d",
+		"path":        `C:\data`,
+	})
+	want := []string{`annotations=a=b\,c=d`, "image.tag=1.0", `path=C:\\data`}
+	if !slices.Equal(got, want) {
+		t.Errorf("helmSetValues() = %v, want %v", got, want)
+	}
+}
+
+// newTestOCIRegistry serves an in-process OCI registry over plain HTTP with the test chart pushed to <registry>/charts/demo.
+func newTestOCIRegistry(t *testing.T) string {
+	t.Helper()
+	server := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+	t.Cleanup(server.Close)
+	host := strings.TrimPrefix(server.URL, "http://")
+	chrt, err := loader.Load(testChartPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chartPath, err := chartutil.Save(chrt, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(chartPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := helmregistry.NewClient(helmregistry.ClientOptPlainHTTP())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Push(data, host+"/charts/demo:0.1.0"); err != nil {
+		t.Fatalf("failed to push chart: %v", err)
+	}
+	return host
+}
+
+func TestHelmOCIChart(t *testing.T) {
+	setTestHelmHome(t)
+	host := newTestOCIRegistry(t)
+	for _, engine := range []helmEngine{HelmEngineCLI, HelmEngineSDK} {
+		t.Run(string(engine), func(t *testing.T) {
+			if _, err := exec.LookPath("helm"); engine == HelmEngineCLI && err != nil {
+				t.Skip("helm not found in PATH")
+			}
+			cacheDir := t.TempDir()
+			builder := newTestBuilder()
+			SetOptions(builder, Options{CacheDir: cacheDir, HelmEngine: engine})
+			app := builder.CreateScope("app", kgen.ScopeProps{Namespace: "app"})
+			AddHelmChart(app, HelmChartProps{ChartInfo: HelmChartInfo{Repo: "oci://" + host + "/charts", Chart: "demo", Version: "0.1.0", PlainHTTP: true}, ReleaseName: "app"})
+			want := []string{"CustomResourceDefinition/widgets.example.com", "ConfigMap/app-config"}
+			if got := objectNames(builder); !slices.Equal(got, want) {
+				t.Errorf("objects = %v, want %v", got, want)
+			}
+			// OCI charts are cached under their registry path
+			cachedChart := filepath.Join(cacheDir, "helm-charts", "oci", strings.ReplaceAll(host, ":", "_"), "charts", "demo-0.1.0.tgz")
+			if _, err := os.Stat(cachedChart); err != nil {
+				t.Errorf("chart not cached at the expected path: %v", err)
+			}
+		})
+	}
+}
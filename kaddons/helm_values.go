@@ -0,0 +1,33 @@
+package kaddons
+
+import (
+	"fmt"
+
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/cli"
+)
+
+// validateHelmValues validates the values against the values.schema.json of the chart and its subcharts, the same way helm template does,
+// so that invalid values (e.g. typos in keys rejected by additionalProperties) are reported before templating.
+func validateHelmValues(props helmTemplateOptions, chartPath string, valuesJson []byte) error {
+	chrt, err := loader.Load(chartPath)
+	if err != nil {
+		return fmt.Errorf("failed to load chart: %w", err)
+	}
+	values, err := mergeHelmValues(cli.New(), props, valuesJson)
+	if err != nil {
+		return fmt.Errorf("failed to read values: %w", err)
+	}
+	if err := chartutil.ProcessDependenciesWithMerge(chrt, values); err != nil {
+		return fmt.Errorf("failed to process chart dependencies: %w", err)
+	}
+	coalesced, err := chartutil.CoalesceValues(chrt, values)
+	if err != nil {
+		return fmt.Errorf("failed to coalesce values: %w", err)
+	}
+	if err := chartutil.ValidateAgainstSchema(chrt, coalesced); err != nil {
+		return fmt.Errorf("invalid values for chart '%s': %w", chrt.Name(), err)
+	}
+	return nil
+}
@@ -0,0 +1,332 @@
+package kaddons
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/format"
+	"maps"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/goccy/go-yaml/ast"
+	"github.com/goccy/go-yaml/parser"
+	"helm.sh/helm/v3/pkg/chart/loader"
+)
+
+// HelmValuesStructOptions configures GenerateHelmValuesStruct.
+type HelmValuesStructOptions struct {
+	// ChartPath is the path of the chart tarball (e.g. a chart cached in Options.CacheDir) or unpacked chart directory.
+	ChartPath string
+	// Package is the package name of the generated file. Default is "values".
+	Package string
+	// TypeName is the name of the generated struct. Default is the chart name in camel case, followed by "Values".
+	TypeName string
+}
+
+// GenerateHelmValuesStruct generates the Go source of a struct for the values of a helm chart, to be passed as HelmChartProps.Values.
+// The struct is generated from the chart's values.schema.json if present, and inferred from its values.yaml otherwise,
+// with the comments above the keys turned into doc comments.
+// Scalar fields are pointers and all fields are omitted when empty, so that the chart's defaults apply to the values that are not set.
+func GenerateHelmValuesStruct(opts HelmValuesStructOptions) ([]byte, error) {
+	if opts.Package == "" {
+		opts.Package = "values"
+	}
+	chrt, err := loader.Load(opts.ChartPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load chart: %w", err)
+	}
+	if opts.TypeName == "" {
+		opts.TypeName = goIdentifier(chrt.Name()) + "Values"
+	}
+	g := &valuesGenerator{declared: map[string]bool{}}
+	doc := fmt.Sprintf("%s are the values of the %s helm chart (version %s).", opts.TypeName, chrt.Name(), chrt.Metadata.Version)
+	if len(chrt.Schema) > 0 {
+		var schema map[string]any
+		if err := json.Unmarshal(chrt.Schema, &schema); err != nil {
+			return nil, fmt.Errorf("failed to parse values.schema.json: %w", err)
+		}
+		g.schemaRoot = schema
+		g.schemaStruct(opts.TypeName, doc, schema)
+	} else {
+		var body ast.Node
+		for _, file := range chrt.Raw {
+			if file.Name != "values.yaml" {
+				continue
+			}
+			f, err := parser.ParseBytes(file.Data, parser.ParseComments)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse values.yaml: %w", err)
+			}
+			if len(f.Docs) > 0 {
+				body = f.Docs[0].Body
+			}
+		}
+		g.yamlStruct(opts.TypeName, doc, body)
+	}
+
+	var src strings.Builder
+	fmt.Fprintf(&src, "// Code generated by kgen-helm-values from %s. DO NOT EDIT.\n\n", chrt.Name())
+	fmt.Fprintf(&src, "package %s\n\n", opts.Package)
+	src.WriteString(strings.Join(g.types, "\n"))
+	out, err := format.Source([]byte(src.String()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to format generated code: %w", err)
+	}
+	return out, nil
+}
+
+type valuesField struct {
+	key    string
+	doc    string
+	goType string
+}
+
+type valuesGenerator struct {
+	types      []string
+	declared   map[string]bool
+	schemaRoot map[string]any
+	// refs holds the schema references being resolved, to break cycles.
+	refs []string
+}
+
+// reserveStruct reserves a unique name for a struct type, and its position in the generated file so that parent types come before their children.
+func (g *valuesGenerator) reserveStruct(name string) (string, int) {
+	for i, base := 2, name; g.declared[name]; i++ {
+		name = fmt.Sprintf("%s%d", base, i)
+	}
+	g.declared[name] = true
+	g.types = append(g.types, "")
+	return name, len(g.types) - 1
+}
+
+// defineStruct generates the struct type reserved with reserveStruct.
+func (g *valuesGenerator) defineStruct(name string, index int, doc string, fields []valuesField) {
+	var src strings.Builder
+	writeDocComment(&src, doc, "")
+	fmt.Fprintf(&src, "type %s struct {\n", name)
+	fieldNames := map[string]bool{}
+	for _, field := range fields {
+		fieldName := goIdentifier(field.key)
+		for i := 2; fieldNames[fieldName]; i++ {
+			fieldName = fmt.Sprintf("%s%d", goIdentifier(field.key), i)
+		}
+		fieldNames[fieldName] = true
+		writeDocComment(&src, field.doc, "\t")
+		fmt.Fprintf(&src, "\t%s %s `json:\"%s,omitempty\"`\n", fieldName, field.goType, field.key)
+	}
+	src.WriteString("}\n")
+	g.types[index] = src.String()
+}
+
+func writeDocComment(src *strings.Builder, doc string, indent string) {
+	doc = strings.TrimSpace(doc)
+	if doc == "" {
+		return
+	}
+	for _, line := range strings.Split(doc, "\n") {
+		fmt.Fprintf(src, "%s// %s\n", indent, strings.TrimRightFunc(line, unicode.IsSpace))
+	}
+}
+
+// goIdentifier converts a values key (e.g. "replicaCount", "image-pull-secrets") to an exported Go identifier.
+func goIdentifier(key string) string {
+	var id strings.Builder
+	upper := true
+	for _, r := range key {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		id.WriteRune(r)
+	}
+	if id.Len() == 0 || unicode.IsDigit([]rune(id.String())[0]) {
+		return "X" + id.String()
+	}
+	return id.String()
+}
+
+func scalarType(goType string, optional bool) string {
+	if optional {
+		return "*" + goType
+	}
+	return goType
+}
+
+// schemaStruct declares a struct for the properties of an object schema and returns its name.
+func (g *valuesGenerator) schemaStruct(name string, doc string, schema map[string]any) string {
+	name, index := g.reserveStruct(name)
+	properties, _ := schema["properties"].(map[string]any)
+	fields := []valuesField{}
+	// JSON objects are unordered, so properties are sorted by key
+	for _, key := range slices.Sorted(maps.Keys(properties)) {
+		property, _ := properties[key].(map[string]any)
+		description, _ := g.resolveRef(property)["description"].(string)
+		fields = append(fields, valuesField{key: key, doc: description, goType: g.schemaType(name+goIdentifier(key), property, true)})
+	}
+	g.defineStruct(name, index, doc, fields)
+	return name
+}
+
+// schemaType returns the Go type for the schema, declaring structs for nested object schemas.
+func (g *valuesGenerator) schemaType(name string, schema map[string]any, optional bool) string {
+	if ref, ok := schema["$ref"].(string); ok {
+		if slices.Contains(g.refs, ref) {
+			return "any"
+		}
+		g.refs = append(g.refs, ref)
+		defer func() { g.refs = g.refs[:len(g.refs)-1] }()
+	}
+	schema = g.resolveRef(schema)
+	if schema == nil {
+		return "any"
+	}
+	switch schemaTypeName(schema) {
+	case "object":
+		if properties, _ := schema["properties"].(map[string]any); len(properties) > 0 {
+			description, _ := schema["description"].(string)
+			return "*" + g.schemaStruct(name, description, schema)
+		}
+		if additionalProperties, ok := schema["additionalProperties"].(map[string]any); ok {
+			return "map[string]" + g.schemaType(name+"Value", additionalProperties, false)
+		}
+		return "map[string]any"
+	case "array":
+		if items, ok := schema["items"].(map[string]any); ok {
+			itemType := g.schemaType(name+"Item", items, false)
+			return "[]" + strings.TrimPrefix(itemType, "*")
+		}
+		return "[]any"
+	case "string":
+		return scalarType("string", optional)
+	case "integer":
+		return scalarType("int64", optional)
+	case "number":
+		return scalarType("float64", optional)
+	case "boolean":
+		return scalarType("bool", optional)
+	}
+	return "any"
+}
+
+// resolveRef returns the schema a local reference ("#/definitions/..." or "#/$defs/...") points to.
+func (g *valuesGenerator) resolveRef(schema map[string]any) map[string]any {
+	for range 32 {
+		ref, ok := schema["$ref"].(string)
+		if !ok {
+			return schema
+		}
+		var target any = g.schemaRoot
+		for _, part := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+			m, _ := target.(map[string]any)
+			target = m[strings.NewReplacer("~1", "/", "~0", "~").Replace(part)]
+		}
+		schema, _ = target.(map[string]any)
+	}
+	return nil
+}
+
+// schemaTypeName returns the (single, non-null) type of the schema, or "" if it has none or several.
+func schemaTypeName(schema map[string]any) string {
+	switch typ := schema["type"].(type) {
+	case string:
+		return typ
+	case []any:
+		types := []string{}
+		for _, t := range typ {
+			if t, ok := t.(string); ok && t != "null" {
+				types = append(types, t)
+			}
+		}
+		if len(types) == 1 {
+			return types[0]
+		}
+		return ""
+	}
+	if _, ok := schema["properties"]; ok {
+		return "object"
+	}
+	if _, ok := schema["items"]; ok {
+		return "array"
+	}
+	return ""
+}
+
+// yamlStruct declares a struct for the keys of a values.yaml mapping and returns its name.
+func (g *valuesGenerator) yamlStruct(name string, doc string, node ast.Node) string {
+	name, index := g.reserveStruct(name)
+	fields := []valuesField{}
+	for _, value := range yamlMappingValues(node) {
+		key := value.Key.String()
+		if keyNode, ok := value.Key.(*ast.StringNode); ok {
+			key = keyNode.Value
+		}
+		fields = append(fields, valuesField{key: key, doc: yamlKeyComment(value), goType: g.yamlType(name+goIdentifier(key), value.Value, true)})
+	}
+	g.defineStruct(name, index, doc, fields)
+	return name
+}
+
+// yamlType returns the Go type inferred from a values.yaml node, declaring structs for nested non-empty mappings.
+func (g *valuesGenerator) yamlType(name string, node ast.Node, optional bool) string {
+	switch n := node.(type) {
+	case *ast.TagNode:
+		return g.yamlType(name, n.Value, optional)
+	case *ast.AnchorNode:
+		return g.yamlType(name, n.Value, optional)
+	case *ast.MappingNode, *ast.MappingValueNode:
+		if len(yamlMappingValues(n)) == 0 {
+			return "map[string]any"
+		}
+		return "*" + g.yamlStruct(name, "", n)
+	case *ast.SequenceNode:
+		if len(n.Values) == 0 {
+			return "[]any"
+		}
+		return "[]" + strings.TrimPrefix(g.yamlType(name+"Item", n.Values[0], false), "*")
+	case *ast.StringNode, *ast.LiteralNode:
+		return scalarType("string", optional)
+	case *ast.IntegerNode:
+		return scalarType("int64", optional)
+	case *ast.FloatNode, *ast.InfinityNode, *ast.NanNode:
+		return scalarType("float64", optional)
+	case *ast.BoolNode:
+		return scalarType("bool", optional)
+	}
+	return "any"
+}
+
+func yamlMappingValues(node ast.Node) []*ast.MappingValueNode {
+	switch n := node.(type) {
+	case *ast.MappingNode:
+		return n.Values
+	case *ast.MappingValueNode:
+		return []*ast.MappingValueNode{n}
+	}
+	return nil
+}
+
+// yamlKeyComment returns the comment block right above the key, aligned with it.
+// Comments separated from the key by a blank line or indented differently (usually commented-out values) are ignored.
+func yamlKeyComment(value *ast.MappingValueNode) string {
+	comment := value.GetComment()
+	if comment == nil {
+		return ""
+	}
+	keyPosition := value.Key.GetToken().Position
+	lines := []string{}
+	line := keyPosition.Line
+	for _, c := range slices.Backward(comment.Comments) {
+		position := c.Token.Position
+		if position.Line != line-1 || position.Column != keyPosition.Column {
+			break
+		}
+		line = position.Line
+		lines = append([]string{strings.TrimPrefix(strings.TrimPrefix(c.Token.Value, "#"), " ")}, lines...)
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,37 @@
+package kaddons
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "update the golden files of the tests")
+
+// TestGenerateHelmValuesStruct compares the struct generated for each chart in testdata/values-gen with its values.go.golden file.
+// Run the test with -update to regenerate the golden files.
+func TestGenerateHelmValuesStruct(t *testing.T) {
+	for _, name := range []string{"yaml", "schema", "duplicates"} {
+		t.Run(name, func(t *testing.T) {
+			chartPath := filepath.Join("testdata", "values-gen", name)
+			got, err := GenerateHelmValuesStruct(HelmValuesStructOptions{ChartPath: chartPath})
+			if err != nil {
+				t.Fatalf("GenerateHelmValuesStruct: %v", err)
+			}
+			goldenPath := filepath.Join(chartPath, "values.go.golden")
+			if *updateGolden {
+				if err := os.WriteFile(goldenPath, got, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(goldenPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != string(want) {
+				t.Errorf("generated struct differs from %s:\n%s", goldenPath, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package kaddons
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestSchemaChart writes a chart whose values.schema.json rejects unknown values.
+func newTestSchemaChart(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	files := map[string]string{
+		"Chart.yaml":  "apiVersion: v2\nname: schema\nversion: 0.1.0\n",
+		"values.yaml": "message: hello\nreplicas: 1\n",
+		"values.schema.json": `{
+  "$schema": "http://json-schema.org/draft-07/schema#",
+  "type": "object",
+  "additionalProperties": false,
+  "properties": {
+    "message": {"type": "string"},
+    "replicas": {"type": "integer"}
+  }
+}`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestValidateHelmValues(t *testing.T) {
+	chartPath := newTestSchemaChart(t)
+	type values struct {
+		Message  string `json:"message,omitempty"`
+		Mesage   string `json:"mesage,omitempty"`
+		Replicas int    `json:"replicas,omitempty"`
+	}
+	validate := func(v values) error {
+		valuesJson, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return validateHelmValues(helmTemplateOptions{}, chartPath, valuesJson)
+	}
+	if err := validate(values{Message: "hi", Replicas: 2}); err != nil {
+		t.Errorf("valid values were rejected: %v", err)
+	}
+	err := validate(values{Mesage: "hi"})
+	if err == nil {
+		t.Fatal("expected the misspelled field to be rejected by additionalProperties")
+	}
+	if !strings.Contains(err.Error(), "invalid values for chart 'schema'") || !strings.Contains(err.Error(), "mesage") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,83 @@
+package kaddons
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+
+	"github.com/blesswinsamuel/kgen"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// KustomizationProps represents the properties required to add a kustomization to the scope.
+type KustomizationProps struct {
+	// Dir is the local directory containing the kustomization.yaml file.
+	Dir string
+	// Namespace is set on the namespaced objects that don't have one, before Include, Exclude and PatchObject. Defaults to the scope's namespace.
+	Namespace string
+	// Include keeps only the objects matching one of the filters. Default is nil (all objects are kept).
+	Include []ObjectFilter
+	// Exclude drops the objects matching one of the filters.
+	Exclude []ObjectFilter
+	// PatchObject is the function to be used to patch the object before adding it to the scope. Default is nil.
+	// Returning ErrDropObject drops the object.
+	PatchObject func(obj runtime.Object) error
+}
+
+// AddKustomization runs kustomize build on a local directory and adds the generated objects to the scope.
+// It uses the kustomize binary if it is in PATH, and falls back to kubectl kustomize.
+func AddKustomization(scope kgen.Scope, props KustomizationProps) {
+	if props.Namespace == "" {
+		props.Namespace = scope.Namespace()
+	}
+	objects, err := execKustomizeBuildAndGetObjects(props.Dir)
+	if err != nil {
+		scope.Logger().Panicf("failed to execute kustomize build: %v", err)
+	}
+	clusterScoped := clusterScopedCRDKinds(objects)
+	for _, object := range objects {
+		if err := setObjectNamespace(scope, object, props.Namespace, clusterScoped); err != nil {
+			scope.Logger().Panicf("failed to set namespace: %v", err)
+		}
+		if keep, err := filterObject(object, props.Include, props.Exclude); err != nil {
+			scope.Logger().Panicf("failed to filter objects: %v", err)
+		} else if !keep {
+			continue
+		}
+		if props.PatchObject != nil {
+			if err := props.PatchObject(object); errors.Is(err, ErrDropObject) {
+				continue
+			} else if err != nil {
+				scope.Logger().Panicf("failed to patch object: %v", err)
+			}
+		}
+		scope.AddApiObject(object)
+	}
+}
+
+func execKustomizeBuildAndGetObjects(dir string) ([]runtime.Object, error) {
+	if dir == "" {
+		return nil, errors.New("kustomization dir is empty")
+	}
+	var cmd *exec.Cmd
+	if _, err := exec.LookPath("kustomize"); err == nil {
+		cmd = exec.Command("kustomize", "build", dir)
+	} else if _, err := exec.LookPath("kubectl"); err == nil {
+		cmd = exec.Command("kubectl", "kustomize", dir)
+	} else {
+		return nil, errors.New("neither kustomize nor kubectl found in PATH")
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		if ee, ok := err.(*exec.ExitError); ok {
+			fmt.Println(string(ee.Stderr))
+		}
+		return nil, fmt.Errorf("kustomize build failed: %w", err)
+	}
+	objects, err := decodeObjects(bytes.NewReader(out))
+	if err != nil {
+		return nil, fmt.Errorf("error decoding kustomize build output: %w", err)
+	}
+	return objects, nil
+}
@@ -0,0 +1,107 @@
+package kaddons
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"testing"
+
+	"github.com/blesswinsamuel/kgen"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	k8sruntime "k8s.io/apimachinery/pkg/runtime"
+)
+
+// setFakeKustomize puts a kustomize binary printing the build.yaml file of the kustomization directory first in PATH.
+func setFakeKustomize(t *testing.T) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake kustomize binary is a shell script")
+	}
+	binDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(binDir, "kustomize"), []byte("#!/bin/sh\ncat \"$2/build.yaml\"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func newTestKustomization(t *testing.T, build string) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "build.yaml"), []byte(build), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+const testKustomizeBuild = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: other-config
+  namespace: other
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: reader
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: credentials
+`
+
+func TestExecKustomizeBuildAndGetObjects(t *testing.T) {
+	setFakeKustomize(t)
+	objects, err := execKustomizeBuildAndGetObjects(newTestKustomization(t, testKustomizeBuild))
+	if err != nil {
+		t.Fatalf("execKustomizeBuildAndGetObjects: %v", err)
+	}
+	names := []string{}
+	for _, object := range objects {
+		names = append(names, object.(*unstructured.Unstructured).GetName())
+	}
+	if want := []string{"config", "other-config", "reader", "credentials"}; !slices.Equal(names, want) {
+		t.Errorf("objects = %v, want %v", names, want)
+	}
+	if _, err := execKustomizeBuildAndGetObjects(""); err == nil {
+		t.Error("expected an error for an empty directory")
+	}
+}
+
+func TestAddKustomizationDefaultsToScopeNamespace(t *testing.T) {
+	setFakeKustomize(t)
+	builder := newTestBuilder()
+	scope := builder.CreateScope("app", kgen.ScopeProps{Namespace: "app"})
+	patched := map[string]string{}
+	AddKustomization(scope, KustomizationProps{
+		Dir:     newTestKustomization(t, testKustomizeBuild),
+		Exclude: []ObjectFilter{{Namespace: "other"}},
+		PatchObject: func(obj k8sruntime.Object) error {
+			u := obj.(*unstructured.Unstructured)
+			patched[u.GetName()] = u.GetNamespace()
+			if u.GetKind() == "Secret" {
+				return ErrDropObject
+			}
+			return nil
+		},
+	})
+	// the filters and PatchObject see the namespace the objects are rendered with
+	if want := map[string]string{"config": "app", "reader": "", "credentials": "app"}; !maps.Equal(patched, want) {
+		t.Errorf("patched objects = %v, want %v", patched, want)
+	}
+	got := map[string]string{}
+	scope.WalkApiObjects(func(object kgen.ApiObject) error {
+		got[object.GetName()] = object.GetNamespace()
+		return nil
+	})
+	if want := map[string]string{"config": "app", "reader": ""}; !maps.Equal(got, want) {
+		t.Errorf("objects = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,103 @@
+package kaddons
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/goccy/go-yaml"
+)
+
+// helmLockFile is the content of the lockfile recording the digests of the charts pulled by AddHelmChart.
+type helmLockFile struct {
+	Charts []helmLockFileEntry `yaml:"charts"`
+}
+
+type helmLockFileEntry struct {
+	Repo    string `yaml:"repo"`
+	Chart   string `yaml:"chart"`
+	Version string `yaml:"version"`
+	Digest  string `yaml:"digest"`
+}
+
+// lockFileMutex serializes the updates to lockfiles.
+var lockFileMutex sync.Mutex
+
+func readHelmLockFile(lockFilePath string) (*helmLockFile, error) {
+	lockFile := &helmLockFile{}
+	data, err := os.ReadFile(lockFilePath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return lockFile, nil
+		}
+		return nil, fmt.Errorf("failed to read lockfile: %w", err)
+	}
+	if err := yaml.Unmarshal(data, lockFile); err != nil {
+		return nil, fmt.Errorf("failed to parse lockfile '%s': %w", lockFilePath, err)
+	}
+	return lockFile, nil
+}
+
+func writeHelmLockFile(lockFilePath string, lockFile *helmLockFile) error {
+	slices.SortFunc(lockFile.Charts, func(a, b helmLockFileEntry) int {
+		return strings.Compare(a.Repo+"\x00"+a.Chart+"\x00"+a.Version, b.Repo+"\x00"+b.Chart+"\x00"+b.Version)
+	})
+	data, err := yaml.MarshalWithOptions(lockFile, yaml.IndentSequence(true))
+	if err != nil {
+		return fmt.Errorf("failed to encode lockfile: %w", err)
+	}
+	if err := os.WriteFile(lockFilePath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write lockfile: %w", err)
+	}
+	return nil
+}
+
+// fileDigest returns the sha256 digest of the file, in the "sha256:<hex>" format.
+func fileDigest(filePath string) (string, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// verifyHelmChartDigest checks the digest of the chart tarball against the lockfile.
+// Charts missing from the lockfile are added to it. In update mode, the digests of the charts are replaced instead of being verified.
+func verifyHelmChartDigest(lockFilePath string, update bool, chartInfo HelmChartInfo, chartPath string) error {
+	digest, err := fileDigest(chartPath)
+	if err != nil {
+		return fmt.Errorf("failed to compute chart digest: %w", err)
+	}
+	lockFileMutex.Lock()
+	defer lockFileMutex.Unlock()
+	lockFile, err := readHelmLockFile(lockFilePath)
+	if err != nil {
+		return err
+	}
+	i := slices.IndexFunc(lockFile.Charts, func(entry helmLockFileEntry) bool {
+		return entry.Repo == chartInfo.Repo && entry.Chart == chartInfo.Chart && entry.Version == chartInfo.Version
+	})
+	if i == -1 {
+		lockFile.Charts = append(lockFile.Charts, helmLockFileEntry{Repo: chartInfo.Repo, Chart: chartInfo.Chart, Version: chartInfo.Version, Digest: digest})
+		return writeHelmLockFile(lockFilePath, lockFile)
+	}
+	if lockFile.Charts[i].Digest == digest {
+		return nil
+	}
+	if !update {
+		return fmt.Errorf("digest of chart '%s' version '%s' from repo '%s' (%s) doesn't match the digest in lockfile '%s' (%s); if the chart was republished, update the lockfile with Options.UpdateLockFile", chartInfo.Chart, chartInfo.Version, chartInfo.Repo, digest, lockFilePath, lockFile.Charts[i].Digest)
+	}
+	lockFile.Charts[i].Digest = digest
+	return writeHelmLockFile(lockFilePath, lockFile)
+}
@@ -0,0 +1,143 @@
+package kaddons
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/blesswinsamuel/kgen"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// manifestFileExtensions are the extensions of the files read when a directory is passed to AddManifestFile.
+var manifestFileExtensions = []string{".yaml", ".yml", ".json"}
+
+// AddManifestFile reads the Kubernetes objects from YAML or JSON files and adds them to the scope.
+// The path can be a file, a directory (all the .yaml, .yml and .json files in it are read recursively) or a glob pattern.
+// Files are read in lexical order.
+func AddManifestFile(scope kgen.Scope, path string) {
+	filePaths, err := findManifestFiles(path)
+	if err != nil {
+		scope.Logger().Panicf("failed to find manifest files: %v", err)
+	}
+	for _, filePath := range filePaths {
+		f, err := os.Open(filePath)
+		if err != nil {
+			scope.Logger().Panicf("failed to open manifest file: %v", err)
+		}
+		objects, err := decodeObjects(f)
+		f.Close()
+		if err != nil {
+			scope.Logger().Panicf("failed to decode manifest file '%s': %v", filePath, err)
+		}
+		for _, object := range objects {
+			scope.AddApiObject(object)
+		}
+	}
+}
+
+// AddManifestsFromReader reads the Kubernetes objects from a multi-document YAML or JSON stream and adds them to the scope.
+func AddManifestsFromReader(scope kgen.Scope, r io.Reader) {
+	objects, err := decodeObjects(r)
+	if err != nil {
+		scope.Logger().Panicf("failed to decode manifests: %v", err)
+	}
+	for _, object := range objects {
+		scope.AddApiObject(object)
+	}
+}
+
+func findManifestFiles(path string) ([]string, error) {
+	matches, err := filepath.Glob(path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid glob pattern: %w", err)
+	}
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("no files match '%s'", path)
+	}
+	filePaths := []string{}
+	for _, match := range matches {
+		info, err := os.Stat(match)
+		if err != nil {
+			return nil, fmt.Errorf("stat failed: %w", err)
+		}
+		if !info.IsDir() {
+			filePaths = append(filePaths, match)
+			continue
+		}
+		err = filepath.WalkDir(match, func(filePath string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && slices.Contains(manifestFileExtensions, strings.ToLower(filepath.Ext(filePath))) {
+				filePaths = append(filePaths, filePath)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("walk directory failed: %w", err)
+		}
+	}
+	slices.Sort(filePaths)
+	return slices.Compact(filePaths), nil
+}
+
+// decodeObjects decodes the Kubernetes objects from a multi-document YAML or JSON stream. Items of List objects are returned as separate objects.
+func decodeObjects(r io.Reader) ([]runtime.Object, error) {
+	reader := yaml.NewYAMLReader(bufio.NewReader(r))
+	var objects []runtime.Object
+	for {
+		document, err := reader.Read()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, fmt.Errorf("error decoding yaml: %w", err)
+		}
+		runtimeObj, err := decodeDocument(document)
+		if err != nil {
+			return nil, err
+		}
+		if runtimeObj == nil {
+			continue
+		}
+		if runtimeObj.IsList() {
+			list, err := runtimeObj.ToList()
+			if err != nil {
+				return nil, fmt.Errorf("error decoding list: %w", err)
+			}
+			for i := range list.Items {
+				objects = append(objects, &list.Items[i])
+			}
+			continue
+		}
+		if runtimeObj.GetKind() == "" {
+			return nil, errors.New("object has no kind")
+		}
+		objects = append(objects, runtimeObj)
+	}
+	return objects, nil
+}
+
+// decodeDocument decodes a single YAML or JSON document as is. It returns nil for empty documents.
+func decodeDocument(document []byte) (*unstructured.Unstructured, error) {
+	var obj map[string]any
+	if len(document) == 0 {
+		return nil, nil
+	}
+	if err := yaml.Unmarshal(document, &obj); err != nil {
+		return nil, fmt.Errorf("error decoding yaml: %w", err)
+	}
+	if len(obj) == 0 {
+		return nil, nil
+	}
+	return &unstructured.Unstructured{Object: obj}, nil
+}
@@ -0,0 +1,121 @@
+package kaddons
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// newTestManifestsDir writes manifest files in a temporary directory, keyed by their path relative to it.
+func newTestManifestsDir(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		filePath := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+var testManifestFiles = map[string]string{
+	"b-config.yaml": `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: b
+---
+# an empty document is skipped
+---
+apiVersion: v1
+kind: List
+items:
+  - apiVersion: v1
+    kind: ConfigMap
+    metadata:
+      name: c
+  - apiVersion: v1
+    kind: Secret
+    metadata:
+      name: d
+`,
+	"a-service.json": `{"apiVersion": "v1", "kind": "Service", "metadata": {"name": "a"}}`,
+	"nested/e.yml": `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: e
+`,
+	"README.md": "not a manifest",
+}
+
+func TestAddManifestFile(t *testing.T) {
+	dir := newTestManifestsDir(t, testManifestFiles)
+	tests := []struct {
+		name string
+		path string
+		want []string
+	}{
+		{name: "file", path: filepath.Join(dir, "b-config.yaml"), want: []string{"ConfigMap/b", "ConfigMap/c", "Secret/d"}},
+		{name: "json file", path: filepath.Join(dir, "a-service.json"), want: []string{"Service/a"}},
+		{name: "directory", path: dir, want: []string{"Service/a", "ConfigMap/b", "ConfigMap/c", "Secret/d", "ConfigMap/e"}},
+		{name: "glob", path: filepath.Join(dir, "*.yaml"), want: []string{"ConfigMap/b", "ConfigMap/c", "Secret/d"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			builder := newTestBuilder()
+			AddManifestFile(builder, tt.path)
+			if got := objectNames(builder); !slices.Equal(got, tt.want) {
+				t.Errorf("objects = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddManifestFilePanicsOnMissingFiles(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("expected a panic for a pattern matching no files")
+		}
+	}()
+	AddManifestFile(newTestBuilder(), filepath.Join(t.TempDir(), "*.yaml"))
+}
+
+func TestAddManifestsFromReader(t *testing.T) {
+	builder := newTestBuilder()
+	AddManifestsFromReader(builder, strings.NewReader(testManifestFiles["b-config.yaml"]))
+	if got, want := objectNames(builder), []string{"ConfigMap/b", "ConfigMap/c", "Secret/d"}; !slices.Equal(got, want) {
+		t.Errorf("objects = %v, want %v", got, want)
+	}
+}
+
+func TestDecodeObjectsRejectsObjectsWithoutKind(t *testing.T) {
+	if _, err := decodeObjects(strings.NewReader("apiVersion: v1\nmetadata:\n  name: a\n")); err == nil {
+		t.Error("expected an error for an object without kind")
+	}
+}
+
+func TestDecodeHelmObjectsKeepsDocuments(t *testing.T) {
+	out := `---
+# Source: demo/templates/list.yaml
+apiVersion: v1
+kind: List
+items:
+  - apiVersion: v1
+    kind: ConfigMap
+    metadata:
+      name: a
+`
+	objects, err := decodeHelmObjects([]byte(out))
+	if err != nil {
+		t.Fatalf("decodeHelmObjects: %v", err)
+	}
+	// helm template output is added as is, List objects are not split
+	if len(objects) != 1 || objects[0].object.GetObjectKind().GroupVersionKind().Kind != "List" || objects[0].source != "demo/templates/list.yaml" {
+		t.Errorf("objects = %v, want the List of demo/templates/list.yaml", objects)
+	}
+}
@@ -7,19 +7,50 @@ import (
 	"github.com/blesswinsamuel/kgen"
 )
 
+type helmEngine string
+
+const (
+	// HelmEngineCLI runs the helm binary (helm pull and helm template) to render charts. It requires helm to be in PATH.
+	HelmEngineCLI helmEngine = "cli"
+	// HelmEngineSDK renders charts in-process using the Helm Go SDK, producing the same output as HelmEngineCLI.
+	HelmEngineSDK helmEngine = "sdk"
+)
+
 // Options for kaddons.
 type Options struct {
-	// CacheDir is the directory where the cache (downloaded helm charts) is stored. Default is os.TempDir() + "/kgen-cache".
+	// CacheDir is the directory where the cache (downloaded helm charts and cached helm template output) is stored. Default is os.TempDir() + "/kgen-cache".
 	CacheDir string
 	// HelmKubeVersion is the kubernetes version passed to helm (kube-version arg) while running helm template. Default is "v1.30.2".
 	HelmKubeVersion string
+	// HelmEngine is the engine used to fetch and render helm charts. Default is HelmEngineCLI.
+	HelmEngine helmEngine
+	// CacheHelmTemplates caches the output of helm template in CacheDir, keyed by the chart digest, helm version, release name, namespace, kube version and values,
+	// so that unchanged charts are not templated again. Charts with non-deterministic output (e.g. generated secrets) will return the cached output.
+	CacheHelmTemplates bool
+	// LockFile is the path of the lockfile (e.g. "kgen.lock") recording the repo, chart, version and sha256 digest of every chart pulled by AddHelmChart,
+	// and of the dependencies downloaded for them.
+	// The digests of the charts are verified against it on every run. Charts missing from it are added. Default is "" (no lockfile).
+	LockFile string
+	// UpdateLockFile pulls the charts again, ignoring the cache, and refreshes their digests in LockFile instead of verifying them.
+	UpdateLockFile bool
+	// Offline makes AddHelmChart fail if a chart is not already in CacheDir, instead of fetching it. See PrefetchHelmCharts.
+	// It can't be turned off by the SetOptions of a child scope.
+	Offline bool
+	// DeferHelmCharts makes AddHelmChart only register the charts, to fetch and template them concurrently with RenderHelmCharts.
+	// The objects of deferred charts are added by RenderHelmCharts at the position AddHelmChart was called in their scope.
+	// RenderManifests panics if RenderHelmCharts wasn't called after the last deferred chart.
+	DeferHelmCharts bool
+	// HelmConcurrency is the maximum number of charts fetched and templated at the same time by RenderHelmCharts. Default is the number of CPUs.
+	HelmConcurrency int
+	// prefetchOnly makes AddHelmChart only fetch the charts. It is set by PrefetchHelmCharts.
+	prefetchOnly bool
 	// Logger is the logger for kaddons. Default is the logger passed to the builder.
 	logger kgen.Logger
 }
 
 var configContextKey = kgen.GenerateContextKey()
 
-// SetOptions sets the options for kaddons.
+// SetOptions sets the options for kaddons. Unset fields are inherited from the options of the parent scopes.
 func SetOptions(scope kgen.Scope, opts Options) {
 	defaultOptions := getAddonsConfig(scope)
 	if opts.CacheDir == "" {
@@ -28,9 +59,20 @@ func SetOptions(scope kgen.Scope, opts Options) {
 	if opts.HelmKubeVersion == "" {
 		opts.HelmKubeVersion = defaultOptions.HelmKubeVersion
 	}
+	if opts.HelmEngine == "" {
+		opts.HelmEngine = defaultOptions.HelmEngine
+	}
+	if opts.LockFile == "" {
+		opts.LockFile = defaultOptions.LockFile
+	}
 	if opts.logger == nil {
 		opts.logger = defaultOptions.logger
 	}
+	if opts.HelmConcurrency == 0 {
+		opts.HelmConcurrency = defaultOptions.HelmConcurrency
+	}
+	opts.Offline = opts.Offline || defaultOptions.Offline
+	opts.prefetchOnly = defaultOptions.prefetchOnly
 	scope.SetContext(configContextKey, opts)
 }
 
@@ -39,8 +81,23 @@ func getAddonsConfig(scope kgen.Scope) Options {
 		return Options{
 			CacheDir:        path.Join(os.TempDir(), "kgen-cache"),
 			HelmKubeVersion: "v1.30.2",
+			HelmEngine:      HelmEngineCLI,
 			logger:          scope.Logger(),
 		}
 	}
 	return scope.GetContext(configContextKey).(Options)
 }
+
+// PrefetchHelmCharts runs build with AddHelmChart only fetching the charts into CacheDir (even if Offline is set), without templating them.
+// build is run against a new builder with the scheme and options of the scope, so that the objects it adds are discarded and the scope is left untouched.
+// Charts are fetched concurrently if DeferHelmCharts is set.
+// Pass it the function that adds the resources to the builder, and run it in a step with network access to populate the cache
+// before rendering the manifests with Offline set in an air-gapped environment.
+func PrefetchHelmCharts(scope kgen.Scope, build func(scope kgen.Scope)) {
+	opts := getAddonsConfig(scope)
+	opts.prefetchOnly = true
+	prefetchBuilder := kgen.NewBuilderFrom(scope)
+	prefetchBuilder.SetContext(configContextKey, opts)
+	build(prefetchBuilder)
+	RenderHelmCharts(prefetchBuilder)
+}
@@ -0,0 +1,48 @@
+package kaddons
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/blesswinsamuel/kgen"
+)
+
+func TestPrefetchHelmCharts(t *testing.T) {
+	setTestHelmHome(t)
+	repoURL := newTestHelmRepo(t)
+	builder := newTestBuilder()
+	SetOptions(builder, Options{CacheDir: t.TempDir(), HelmEngine: HelmEngineSDK, Offline: true})
+	build := func(scope kgen.Scope) {
+		app := scope.CreateScope("app", kgen.ScopeProps{Namespace: "app"})
+		app.AddApiObjectFromMap(map[string]any{"apiVersion": "v1", "kind": "ConfigMap", "metadata": map[string]any{"name": "settings"}})
+		AddHelmChart(app, HelmChartProps{ChartInfo: HelmChartInfo{Repo: repoURL, Chart: "demo", Version: "0.1.0"}, ReleaseName: "app"})
+	}
+	PrefetchHelmCharts(builder, build)
+	if got := objectNames(builder); len(got) != 0 {
+		t.Fatalf("PrefetchHelmCharts added objects to the builder: %v", got)
+	}
+	// the chart is now rendered from the cache in offline mode
+	build(builder)
+	want := []string{"ConfigMap/settings", "CustomResourceDefinition/widgets.example.com", "ConfigMap/app-config"}
+	if got := objectNames(builder); !slices.Equal(got, want) {
+		t.Errorf("objects = %v, want %v", got, want)
+	}
+}
+
+func TestSetOptionsKeepsOfflineOfParent(t *testing.T) {
+	setTestHelmHome(t)
+	repoURL := newTestHelmRepo(t)
+	builder := newTestBuilder()
+	SetOptions(builder, Options{CacheDir: t.TempDir(), HelmEngine: HelmEngineSDK, Offline: true})
+	app := builder.CreateScope("app", kgen.ScopeProps{Namespace: "app"})
+	SetOptions(app, Options{HelmKubeVersion: "v1.29.0"})
+	if !getAddonsConfig(app).Offline {
+		t.Fatal("SetOptions of the child scope turned offline mode off")
+	}
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("expected AddHelmChart to panic on a chart missing from the cache in offline mode")
+		}
+	}()
+	AddHelmChart(app, HelmChartProps{ChartInfo: HelmChartInfo{Repo: repoURL, Chart: "demo", Version: "0.1.0"}, ReleaseName: "app"})
+}
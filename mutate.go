@@ -0,0 +1,94 @@
+package kgen
+
+import (
+	"fmt"
+	"reflect"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// Mutate converts the object to its Go type in the builder's scheme (e.g. *appsv1.Deployment), calls fn with it, and writes the result back to the object.
+// It fails if the kind of the object is not registered in the scheme, or if its Go type is not T.
+// The zero values the conversion to the Go type adds to the untouched parts of the object (e.g. creationTimestamp: null, status: {}) are dropped.
+//
+//	err := kgen.Mutate(obj, func(deployment *appsv1.Deployment) error {
+//		deployment.Spec.Replicas = ptr.To(int32(3))
+//		return nil
+//	})
+func Mutate[T runtime.Object](obj ApiObject, fn func(T) error) error {
+	a, ok := obj.(*apiObject)
+	if !ok {
+		return fmt.Errorf("unsupported ApiObject implementation %T", obj)
+	}
+	gvk := a.GroupVersionKind()
+	typed, err := a.globalContext.scheme.New(gvk)
+	if runtime.IsNotRegisteredError(err) {
+		return fmt.Errorf("kind '%s' of '%s' is not registered in the builder's scheme", gvk, a.GetName())
+	} else if err != nil {
+		return fmt.Errorf("failed to create object of kind '%s': %w", gvk, err)
+	}
+	typedObj, ok := typed.(T)
+	if !ok {
+		return fmt.Errorf("'%s' is of kind '%s' (%T), not %s", a.GetName(), gvk, typed, reflect.TypeFor[T]())
+	}
+	// the untouched object converted back and forth tells which fields are only added by the conversion (e.g. creationTimestamp: null, status: {})
+	baseline, err := convertToUnstructured(a.Object, typed.DeepCopyObject())
+	if err != nil {
+		return fmt.Errorf("failed to convert '%s': %w", a.GetName(), err)
+	}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(a.Object, typedObj); err != nil {
+		return fmt.Errorf("failed to convert '%s' to %T: %w", a.GetName(), typedObj, err)
+	}
+	if err := fn(typedObj); err != nil {
+		return err
+	}
+	mobj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(typedObj)
+	if err != nil {
+		return fmt.Errorf("failed to convert '%s' to unstructured: %w", a.GetName(), err)
+	}
+	mobj["apiVersion"] = gvk.GroupVersion().String()
+	mobj["kind"] = gvk.Kind
+	dropConversionFields(mobj, baseline, a.Object)
+	a.Unstructured = &unstructured.Unstructured{Object: mobj}
+	return nil
+}
+
+func convertToUnstructured(obj map[string]any, typed runtime.Object) (map[string]any, error) {
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj, typed); err != nil {
+		return nil, err
+	}
+	return runtime.DefaultUnstructuredConverter.ToUnstructured(typed)
+}
+
+// dropConversionFields removes the fields of converted that the conversion added to baseline (they are not in original) and that are still unchanged.
+// These are zero values of fields without omitempty, so dropping them doesn't change the meaning of the object.
+// List items are compared by index, which can only drop such zero values, never fields set by the mutation.
+func dropConversionFields(converted map[string]any, baseline map[string]any, original map[string]any) {
+	for key, value := range converted {
+		baselineValue, inBaseline := baseline[key]
+		originalValue, inOriginal := original[key]
+		if inBaseline && !inOriginal && reflect.DeepEqual(value, baselineValue) {
+			delete(converted, key)
+			continue
+		}
+		switch value := value.(type) {
+		case map[string]any:
+			baselineMap, _ := baselineValue.(map[string]any)
+			originalMap, _ := originalValue.(map[string]any)
+			dropConversionFields(value, baselineMap, originalMap)
+		case []any:
+			baselineList, _ := baselineValue.([]any)
+			originalList, _ := originalValue.([]any)
+			for i, item := range value {
+				itemMap, ok := item.(map[string]any)
+				if !ok || i >= len(baselineList) || i >= len(originalList) {
+					continue
+				}
+				baselineItemMap, _ := baselineList[i].(map[string]any)
+				originalItemMap, _ := originalList[i].(map[string]any)
+				dropConversionFields(itemMap, baselineItemMap, originalItemMap)
+			}
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package kgen
+
+import (
+	"reflect"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func newTestDeployment(t *testing.T) ApiObject {
+	t.Helper()
+	builder := NewBuilder(BuilderOptions{SchemeBuilder: runtime.SchemeBuilder{appsv1.AddToScheme, corev1.AddToScheme}})
+	return builder.AddApiObjectFromMap(map[string]any{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   map[string]any{"name": "web"},
+		"spec": map[string]any{
+			"template": map[string]any{
+				"spec": map[string]any{
+					"containers": []any{map[string]any{"name": "web", "image": "nginx"}},
+					"volumes":    []any{map[string]any{"name": "config", "configMap": map[string]any{"name": "web"}}},
+				},
+			},
+		},
+	})
+}
+
+func TestMutateKeepsAddedEmptyDirVolume(t *testing.T) {
+	obj := newTestDeployment(t)
+	err := Mutate(obj, func(deployment *appsv1.Deployment) error {
+		volumes := deployment.Spec.Template.Spec.Volumes
+		deployment.Spec.Template.Spec.Volumes = append([]corev1.Volume{{
+			Name:         "cache",
+			VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+		}}, volumes...)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Mutate: %v", err)
+	}
+	u := obj.GetObject().(*unstructured.Unstructured).Object
+	volumes, _, _ := unstructured.NestedSlice(u, "spec", "template", "spec", "volumes")
+	want := []any{
+		map[string]any{"name": "cache", "emptyDir": map[string]any{}},
+		map[string]any{"name": "config", "configMap": map[string]any{"name": "web"}},
+	}
+	if !reflect.DeepEqual(volumes, want) {
+		t.Errorf("volumes = %v, want %v", volumes, want)
+	}
+}
+
+func TestMutateDropsConversionFields(t *testing.T) {
+	obj := newTestDeployment(t)
+	err := Mutate(obj, func(deployment *appsv1.Deployment) error {
+		replicas := int32(3)
+		deployment.Spec.Replicas = &replicas
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Mutate: %v", err)
+	}
+	u := obj.GetObject().(*unstructured.Unstructured).Object
+	for _, fields := range [][]string{
+		{"status"},
+		{"metadata", "creationTimestamp"},
+		{"spec", "strategy"},
+		{"spec", "selector"},
+		{"spec", "template", "metadata"},
+	} {
+		if _, found, _ := unstructured.NestedFieldNoCopy(u, fields...); found {
+			t.Errorf("unexpected field %v added by the conversion", fields)
+		}
+	}
+	containers, _, _ := unstructured.NestedSlice(u, "spec", "template", "spec", "containers")
+	if want := []any{map[string]any{"name": "web", "image": "nginx"}}; !reflect.DeepEqual(containers, want) {
+		t.Errorf("containers = %v, want %v", containers, want)
+	}
+	if replicas, _, _ := unstructured.NestedInt64(u, "spec", "replicas"); replicas != 3 {
+		t.Errorf("replicas = %d, want 3", replicas)
+	}
+}
+
+func TestMutateErrors(t *testing.T) {
+	obj := newTestDeployment(t)
+	if err := Mutate(obj, func(*corev1.Service) error { return nil }); err == nil {
+		t.Error("expected an error for a mismatching type")
+	}
+	builder := NewBuilder(BuilderOptions{SchemeBuilder: runtime.SchemeBuilder{appsv1.AddToScheme}})
+	widget := builder.AddApiObjectFromMap(map[string]any{"apiVersion": "example.com/v1", "kind": "Widget", "metadata": map[string]any{"name": "w"}})
+	if err := Mutate(widget, func(*appsv1.Deployment) error { return nil }); err == nil {
+		t.Error("expected an error for an unregistered kind")
+	}
+}
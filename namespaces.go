@@ -0,0 +1,91 @@
+package kgen
+
+import (
+	"maps"
+	"slices"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// NamespaceProps configures the Namespace objects generated by kgen.
+type NamespaceProps struct {
+	// Labels are added to the generated Namespace (e.g. Pod Security Admission labels).
+	Labels map[string]string
+	// Annotations are added to the generated Namespace.
+	Annotations map[string]string
+	// ExcludeNamespaces are namespaces for which RenderManifestsOptions.GenerateNamespaces doesn't generate a Namespace (e.g. namespaces managed elsewhere),
+	// in addition to the ones created by Kubernetes (see BuiltinNamespaces).
+	ExcludeNamespaces []string
+}
+
+// BuiltinNamespaces are the namespaces created by Kubernetes, which RenderManifestsOptions.GenerateNamespaces doesn't generate a Namespace for.
+// A Namespace is still generated for them if a scope asks for it with ScopeProps.CreateNamespace.
+var BuiltinNamespaces = []string{"default", "kube-system", "kube-public", "kube-node-lease"}
+
+type generatedNamespace struct {
+	scope       *scope
+	labels      map[string]string
+	annotations map[string]string
+}
+
+// generateNamespaces adds a Namespace object for the namespaces used in the tree that don't have one already.
+// The Namespace is added at the beginning of the first scope using the namespace.
+func generateNamespaces(root *scope, props *NamespaceProps) {
+	existing := map[string]bool{}
+	_ = root.WalkApiObjects(func(apiObject ApiObject) error {
+		if apiObject.GetAPIVersion() == "v1" && apiObject.GetKind() == "Namespace" {
+			existing[apiObject.GetName()] = true
+		}
+		return nil
+	})
+	names := []string{}
+	namespaces := map[string]*generatedNamespace{}
+	register := func(name string, s *scope, props *NamespaceProps) {
+		if existing[name] {
+			return
+		}
+		if _, ok := namespaces[name]; !ok {
+			names = append(names, name)
+			namespaces[name] = &generatedNamespace{scope: s, labels: map[string]string{}, annotations: map[string]string{}}
+		}
+		maps.Copy(namespaces[name].labels, props.Labels)
+		maps.Copy(namespaces[name].annotations, props.Annotations)
+	}
+	var walk func(s *scope)
+	walk = func(s *scope) {
+		if props != nil {
+			for _, apiObject := range s.objects {
+				if namespace := apiObject.GetNamespace(); namespace != "" && !slices.Contains(BuiltinNamespaces, namespace) && !slices.Contains(props.ExcludeNamespaces, namespace) {
+					register(namespace, s, props)
+				}
+			}
+		}
+		// scope specific props are registered after the builder-wide ones so that they take precedence
+		if namespace, _ := s.context[namespaceContextKey].(string); namespace != "" && s.namespaceProps != nil {
+			register(namespace, s, s.namespaceProps)
+		}
+		for _, child := range s.children {
+			walk(child)
+		}
+	}
+	walk(root)
+
+	inserted := map[*scope]int{}
+	for _, name := range names {
+		namespace := namespaces[name]
+		obj := &unstructured.Unstructured{Object: map[string]any{}}
+		obj.SetAPIVersion("v1")
+		obj.SetKind("Namespace")
+		obj.SetName(name)
+		if len(namespace.labels) > 0 {
+			obj.SetLabels(namespace.labels)
+		}
+		if len(namespace.annotations) > 0 {
+			obj.SetAnnotations(namespace.annotations)
+		}
+		s := namespace.scope
+		apiObject := &apiObject{apiObjectProps: apiObjectProps{Unstructured: obj}, globalContext: s.globalContext}
+		s.objects = append(s.objects[:inserted[s]], append([]ApiObject{apiObject}, s.objects[inserted[s]:]...)...)
+		inserted[s]++
+	}
+}
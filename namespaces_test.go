@@ -0,0 +1,30 @@
+package kgen
+
+import (
+	"slices"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestGenerateNamespacesSkipsBuiltinAndExcludedNamespaces(t *testing.T) {
+	builder := NewBuilder(BuilderOptions{SchemeBuilder: runtime.SchemeBuilder{corev1.AddToScheme}})
+	for _, namespace := range []string{"app", "kube-system", "default", "kube-public", "kube-node-lease", "managed"} {
+		addTestConfigMap(builder.CreateScope(namespace, ScopeProps{Namespace: namespace}), "config")
+	}
+	addTestConfigMap(builder.CreateScope("system", ScopeProps{Namespace: "kube-system", CreateNamespace: &NamespaceProps{Labels: map[string]string{"team": "platform"}}}), "config")
+	builder.RenderManifests(RenderManifestsOptions{Outdir: t.TempDir(), GenerateNamespaces: &NamespaceProps{ExcludeNamespaces: []string{"managed"}}})
+
+	namespaces := []string{}
+	_ = builder.WalkApiObjects(func(object ApiObject) error {
+		if object.GetKind() == "Namespace" {
+			namespaces = append(namespaces, object.GetName())
+		}
+		return nil
+	})
+	// kube-system is still generated for the scope asking for it explicitly
+	if want := []string{"app", "kube-system"}; !slices.Equal(namespaces, want) {
+		t.Errorf("generated namespaces = %v, want %v", namespaces, want)
+	}
+}
@@ -0,0 +1,59 @@
+package kgen
+
+import (
+	"fmt"
+
+	jsonpatch "gopkg.in/evanphx/json-patch.v4"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"sigs.k8s.io/yaml"
+)
+
+func (a *apiObject) JSONPatch(patch []byte) error {
+	return a.applyPatch(patch, func(original, patch []byte) ([]byte, error) {
+		jsonPatch, err := jsonpatch.DecodePatch(patch)
+		if err != nil {
+			return nil, fmt.Errorf("invalid json patch: %w", err)
+		}
+		return jsonPatch.Apply(original)
+	})
+}
+
+func (a *apiObject) MergePatch(patch []byte) error {
+	return a.applyPatch(patch, jsonpatch.MergePatch)
+}
+
+func (a *apiObject) StrategicMergePatch(patch []byte) error {
+	dataStruct, err := a.globalContext.scheme.New(a.GroupVersionKind())
+	if runtime.IsNotRegisteredError(err) {
+		return a.MergePatch(patch)
+	} else if err != nil {
+		return fmt.Errorf("failed to create object of kind '%s': %w", a.GroupVersionKind(), err)
+	}
+	return a.applyPatch(patch, func(original, patch []byte) ([]byte, error) {
+		return strategicpatch.StrategicMergePatch(original, patch, dataStruct)
+	})
+}
+
+// applyPatch converts the patch to JSON, applies it to the JSON representation of the object and replaces the object with the result.
+func (a *apiObject) applyPatch(patch []byte, apply func(original, patch []byte) ([]byte, error)) error {
+	patchJSON, err := yaml.YAMLToJSON(patch)
+	if err != nil {
+		return fmt.Errorf("failed to parse patch: %w", err)
+	}
+	original, err := a.Unstructured.MarshalJSON()
+	if err != nil {
+		return fmt.Errorf("failed to marshal object: %w", err)
+	}
+	patched, err := apply(original, patchJSON)
+	if err != nil {
+		return fmt.Errorf("failed to patch '%s/%s': %w", a.GetKind(), a.GetName(), err)
+	}
+	obj := &unstructured.Unstructured{}
+	if err := obj.UnmarshalJSON(patched); err != nil {
+		return fmt.Errorf("failed to unmarshal patched object: %w", err)
+	}
+	a.Unstructured = obj
+	return nil
+}
@@ -0,0 +1,93 @@
+package kgen
+
+import (
+	"reflect"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestStrategicMergePatchMergesContainersByName(t *testing.T) {
+	obj := newTestDeployment(t)
+	err := obj.StrategicMergePatch([]byte(`
+spec:
+  template:
+    spec:
+      containers:
+        - name: sidecar
+          image: envoy
+`))
+	if err != nil {
+		t.Fatalf("StrategicMergePatch: %v", err)
+	}
+	containers, _, _ := unstructured.NestedSlice(obj.GetObject().(*unstructured.Unstructured).Object, "spec", "template", "spec", "containers")
+	want := []any{
+		map[string]any{"name": "web", "image": "nginx"},
+		map[string]any{"name": "sidecar", "image": "envoy"},
+	}
+	if len(containers) != len(want) {
+		t.Fatalf("containers = %v, want %v", containers, want)
+	}
+	// the containers are merged by name instead of being replaced, regardless of their order
+	for _, w := range want {
+		found := false
+		for _, c := range containers {
+			found = found || reflect.DeepEqual(c, w)
+		}
+		if !found {
+			t.Errorf("containers = %v, want %v", containers, want)
+		}
+	}
+}
+
+func TestJSONPatch(t *testing.T) {
+	obj := newTestDeployment(t)
+	err := obj.JSONPatch([]byte(`
+- op: replace
+  path: /spec/template/spec/containers/0/image
+  value: nginx:1.27
+- op: add
+  path: /metadata/labels
+  value: {app: web}
+`))
+	if err != nil {
+		t.Fatalf("JSONPatch: %v", err)
+	}
+	u := obj.GetObject().(*unstructured.Unstructured)
+	containers, _, _ := unstructured.NestedSlice(u.Object, "spec", "template", "spec", "containers")
+	if image := containers[0].(map[string]any)["image"]; image != "nginx:1.27" {
+		t.Errorf("image = %v, want nginx:1.27", image)
+	}
+	if labels := u.GetLabels(); !reflect.DeepEqual(labels, map[string]string{"app": "web"}) {
+		t.Errorf("labels = %v, want app=web", labels)
+	}
+	if err := obj.JSONPatch([]byte(`[{"op": "remove", "path": "/spec/missing"}]`)); err == nil {
+		t.Error("expected an error for a patch removing a missing path")
+	}
+}
+
+func TestStrategicMergePatchFallsBackToMergePatchForUnregisteredKinds(t *testing.T) {
+	builder := NewBuilder(BuilderOptions{SchemeBuilder: runtime.SchemeBuilder{appsv1.AddToScheme}})
+	obj := builder.AddApiObjectFromMap(map[string]any{
+		"apiVersion": "example.com/v1",
+		"kind":       "Widget",
+		"metadata":   map[string]any{"name": "widget"},
+		"spec": map[string]any{
+			"size":  "small",
+			"color": "red",
+			"items": []any{map[string]any{"name": "a"}, map[string]any{"name": "b"}},
+		},
+	})
+	err := obj.StrategicMergePatch([]byte(`{"spec": {"size": "large", "color": null, "items": [{"name": "c"}]}}`))
+	if err != nil {
+		t.Fatalf("StrategicMergePatch: %v", err)
+	}
+	spec, _, _ := unstructured.NestedMap(obj.GetObject().(*unstructured.Unstructured).Object, "spec")
+	// lists are replaced, as there are no merge keys for unregistered kinds
+	want := map[string]any{"size": "large", "items": []any{map[string]any{"name": "c"}}}
+	if !reflect.DeepEqual(spec, want) {
+		t.Errorf("spec = %v, want %v", spec, want)
+	}
+}
@@ -0,0 +1,50 @@
+package kgen
+
+import (
+	"slices"
+
+	"github.com/blesswinsamuel/kgen/internal"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// PreInstallOptions configures moving the objects other objects depend on (like CRDs and Namespaces) into a separate file,
+// so that they can be applied before the rest of the manifests.
+type PreInstallOptions struct {
+	// Filename is the file (relative to Outdir, without extension) the objects are written to. Default is "00-crds".
+	Filename string
+	// ExtraKinds are moved to the file in addition to Namespaces and CustomResourceDefinitions (e.g. PriorityClasses).
+	ExtraKinds []schema.GroupKind
+}
+
+var defaultPreInstallKinds = []schema.GroupKind{
+	{Group: "", Kind: "Namespace"},
+	{Group: "apiextensions.k8s.io", Kind: "CustomResourceDefinition"},
+}
+
+// extractPreInstallObjects moves the objects of the pre-install kinds out of the files they were rendered to, regardless of the scope that added them.
+// They are returned ordered by kind, in the order the kinds are listed.
+func extractPreInstallObjects(files map[string][]ApiObject, opts PreInstallOptions) []ApiObject {
+	kinds := append(slices.Clone(defaultPreInstallKinds), opts.ExtraKinds...)
+	preInstallObjects := map[schema.GroupKind][]ApiObject{}
+	for _, filePath := range internal.MapKeysSorted(files) {
+		apiObjects := []ApiObject{}
+		for _, apiObject := range files[filePath] {
+			groupKind := apiObject.GetObject().GetObjectKind().GroupVersionKind().GroupKind()
+			if slices.Contains(kinds, groupKind) {
+				preInstallObjects[groupKind] = append(preInstallObjects[groupKind], apiObject)
+			} else {
+				apiObjects = append(apiObjects, apiObject)
+			}
+		}
+		if len(apiObjects) == 0 {
+			delete(files, filePath)
+		} else {
+			files[filePath] = apiObjects
+		}
+	}
+	out := []ApiObject{}
+	for _, kind := range kinds {
+		out = append(out, preInstallObjects[kind]...)
+	}
+	return out
+}
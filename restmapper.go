@@ -0,0 +1,74 @@
+package kgen
+
+import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// builtinClusterScopedKinds are the cluster-scoped kinds of the built-in Kubernetes API groups.
+var builtinClusterScopedKinds = []schema.GroupKind{
+	{Group: "", Kind: "Namespace"},
+	{Group: "", Kind: "Node"},
+	{Group: "", Kind: "PersistentVolume"},
+	{Group: "", Kind: "ComponentStatus"},
+	{Group: "rbac.authorization.k8s.io", Kind: "ClusterRole"},
+	{Group: "rbac.authorization.k8s.io", Kind: "ClusterRoleBinding"},
+	{Group: "apiextensions.k8s.io", Kind: "CustomResourceDefinition"},
+	{Group: "apiregistration.k8s.io", Kind: "APIService"},
+	{Group: "admissionregistration.k8s.io", Kind: "MutatingWebhookConfiguration"},
+	{Group: "admissionregistration.k8s.io", Kind: "ValidatingWebhookConfiguration"},
+	{Group: "admissionregistration.k8s.io", Kind: "ValidatingAdmissionPolicy"},
+	{Group: "admissionregistration.k8s.io", Kind: "ValidatingAdmissionPolicyBinding"},
+	{Group: "admissionregistration.k8s.io", Kind: "MutatingAdmissionPolicy"},
+	{Group: "admissionregistration.k8s.io", Kind: "MutatingAdmissionPolicyBinding"},
+	{Group: "storage.k8s.io", Kind: "StorageClass"},
+	{Group: "storage.k8s.io", Kind: "CSIDriver"},
+	{Group: "storage.k8s.io", Kind: "CSINode"},
+	{Group: "storage.k8s.io", Kind: "VolumeAttachment"},
+	{Group: "storage.k8s.io", Kind: "VolumeAttributesClass"},
+	{Group: "scheduling.k8s.io", Kind: "PriorityClass"},
+	{Group: "node.k8s.io", Kind: "RuntimeClass"},
+	{Group: "networking.k8s.io", Kind: "IngressClass"},
+	{Group: "networking.k8s.io", Kind: "IPAddress"},
+	{Group: "networking.k8s.io", Kind: "ServiceCIDR"},
+	{Group: "certificates.k8s.io", Kind: "CertificateSigningRequest"},
+	{Group: "certificates.k8s.io", Kind: "ClusterTrustBundle"},
+	{Group: "flowcontrol.apiserver.k8s.io", Kind: "FlowSchema"},
+	{Group: "flowcontrol.apiserver.k8s.io", Kind: "PriorityLevelConfiguration"},
+	{Group: "policy", Kind: "PodSecurityPolicy"},
+	{Group: "resource.k8s.io", Kind: "DeviceClass"},
+}
+
+// resourceScopes keeps track of the kinds that are cluster-scoped, i.e. that must not get the scope's namespace.
+type resourceScopes struct {
+	clusterScoped map[schema.GroupKind]bool
+}
+
+func newResourceScopes(extraClusterScopedKinds []schema.GroupKind) *resourceScopes {
+	r := &resourceScopes{clusterScoped: map[schema.GroupKind]bool{}}
+	for _, groupKind := range append(builtinClusterScopedKinds, extraClusterScopedKinds...) {
+		r.clusterScoped[groupKind] = true
+	}
+	return r
+}
+
+func (r *resourceScopes) isClusterScoped(groupKind schema.GroupKind) bool {
+	return r.clusterScoped[groupKind]
+}
+
+// learnFromCRD registers the kind defined by the given CustomResourceDefinition if it is cluster-scoped.
+// It returns the kind and whether it was newly registered.
+func (r *resourceScopes) learnFromCRD(obj *unstructured.Unstructured) (schema.GroupKind, bool) {
+	if obj.GroupVersionKind().GroupKind() != (schema.GroupKind{Group: "apiextensions.k8s.io", Kind: "CustomResourceDefinition"}) {
+		return schema.GroupKind{}, false
+	}
+	crdScope, _, _ := unstructured.NestedString(obj.Object, "spec", "scope")
+	group, _, _ := unstructured.NestedString(obj.Object, "spec", "group")
+	kind, _, _ := unstructured.NestedString(obj.Object, "spec", "names", "kind")
+	groupKind := schema.GroupKind{Group: group, Kind: kind}
+	if crdScope != "Cluster" || kind == "" || r.clusterScoped[groupKind] {
+		return groupKind, false
+	}
+	r.clusterScoped[groupKind] = true
+	return groupKind, true
+}
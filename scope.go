@@ -3,15 +3,19 @@ package kgen
 import (
 	"fmt"
 	"iter"
+	"slices"
 
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
 type Scope interface {
 	// ID returns the identifier of the scope.
 	ID() string
-	// Namespace returns the namespace of the scope. It searches the current scope and its parents.
+	// Path returns the IDs of the scopes from the top-level scope down to the current scope. It is empty for the builder.
+	Path() []string
+	// Namespace returns the namespace of the scope. It searches the current scope and its parents, and is empty if none of them has one.
 	Namespace() string
 	// CreateScope creates a new scope, nested under the current scope.
 	CreateScope(id string, props ScopeProps) Scope
@@ -22,7 +26,11 @@ type Scope interface {
 	// AddApiObject adds a new API object to the scope.
 	AddApiObject(obj runtime.Object) ApiObject
 	// AddApiObjectFromMap adds a new API object to the scope from an arbitrary map.
+	// The scope's namespace is set on the object if it doesn't have one, unless its kind is cluster-scoped (see IsClusterScoped).
 	AddApiObjectFromMap(props map[string]any) ApiObject
+	// IsClusterScoped returns whether objects of the given kind are cluster-scoped.
+	// Built-in kinds, kinds passed in BuilderOptions.ClusterScopedKinds and kinds defined by cluster-scoped CustomResourceDefinitions added to the builder are known.
+	IsClusterScoped(groupKind schema.GroupKind) bool
 	// WalkApiObjects walks through all the API objects in the scope and its children.
 	WalkApiObjects(walkFn func(ApiObject) error) error
 	// Children returns the child scopes of the current scope.
@@ -35,30 +43,55 @@ type Scope interface {
 type ScopeProps struct {
 	// Namespace is the default kubernetes namespace that should be used for the k8s resources in the scope.
 	Namespace string
+	// YamlOutputType overrides RenderManifestsOptions.YamlOutputType for the scope and its children.
+	// With YamlOutputTypeSingleFile, the subtree is rendered to a single file named after the scope.
+	YamlOutputType yamlOutputType
+	// CreateNamespace, if set, generates a Namespace object for Namespace while rendering, unless one was added explicitly.
+	// The props are merged over RenderManifestsOptions.GenerateNamespaces.
+	CreateNamespace *NamespaceProps
 }
 
 type scope struct {
-	id            string
-	globalContext *globalContext
-	context       map[string]any
-	parent        *scope
-	children      []*scope
-	objects       []ApiObject
+	id             string
+	globalContext  *globalContext
+	context        map[string]any
+	parent         *scope
+	children       []*scope
+	objects        []ApiObject
+	namespaceProps *NamespaceProps
+	// position is set for placeholder scopes (see Placeholder), whose objects and children are inserted into their parent.
+	position *placeholderPosition
+	// placeholders are the positions reserved in the scope, in order.
+	placeholders []*placeholderPosition
+}
+
+// placeholderPosition is the position in the objects and children of a scope where the next object and child scope of a placeholder are inserted.
+type placeholderPosition struct {
+	objectIndex int
+	childIndex  int
 }
 
 func newScope(id string, props ScopeProps, globalContext *globalContext) Scope {
 	scope := &scope{
-		id:            id,
-		context:       map[string]any{},
-		globalContext: globalContext,
+		id:             id,
+		context:        map[string]any{},
+		globalContext:  globalContext,
+		namespaceProps: props.CreateNamespace,
 	}
 	if props.Namespace != "" {
 		scope.context[namespaceContextKey] = props.Namespace
 	}
+	if props.YamlOutputType != "" {
+		scope.context[yamlOutputTypeContextKey] = props.YamlOutputType
+	}
 	return scope
 }
 
 func (s *scope) SetContext(key string, value any) {
+	if s.position != nil {
+		s.parent.SetContext(key, value)
+		return
+	}
 	s.context[key] = value
 }
 
@@ -75,15 +108,73 @@ func (s *scope) ID() string {
 	return s.id
 }
 
+func (s *scope) Path() []string {
+	path := []string{}
+	for s := s; s.parent != nil; s = s.parent {
+		if s.position == nil {
+			path = append([]string{s.id}, path...)
+		}
+	}
+	return path
+}
+
 func (s *scope) CreateScope(id string, props ScopeProps) Scope {
 	childScope := newScope(id, props, s.globalContext).(*scope)
+	if s.position != nil {
+		s.children = append(s.children, childScope)
+		childScope.parent = s.parent
+		s.parent.children = slices.Insert(s.parent.children, s.position.childIndex, childScope)
+		s.parent.shiftPlaceholders(s.position, 0, 1)
+		return childScope
+	}
 	childScope.parent = s
 	s.children = append(s.children, childScope)
 	return childScope
 }
 
+// Root, Placeholder and OnRenderManifests are not part of the Scope interface. They are used by kaddons to render helm charts concurrently,
+// through an interface assertion.
+
+// Root returns the top-level scope of the builder. Its context is visible to all the scopes.
+func (s *scope) Root() Scope {
+	return s.root()
+}
+
+// Placeholder returns a scope that reserves the current position in the scope, to add objects to it later (e.g. after rendering them concurrently).
+// The objects and child scopes added to the placeholder are placed in the scope as if they had been added when Placeholder was called.
+// It shares the ID, path and context of the scope.
+func (s *scope) Placeholder() Scope {
+	placeholder := &scope{id: s.id, context: map[string]any{}, globalContext: s.globalContext, parent: s}
+	if s.position != nil {
+		// a placeholder of a placeholder reserves the current position of the placeholder, before its next objects
+		placeholder.parent = s.parent
+		placeholder.position = &placeholderPosition{objectIndex: s.position.objectIndex, childIndex: s.position.childIndex}
+		i := slices.Index(s.parent.placeholders, s.position)
+		s.parent.placeholders = slices.Insert(s.parent.placeholders, i, placeholder.position)
+		return placeholder
+	}
+	placeholder.position = &placeholderPosition{objectIndex: len(s.objects), childIndex: len(s.children)}
+	s.placeholders = append(s.placeholders, placeholder.position)
+	return placeholder
+}
+
+// shiftPlaceholders moves the given position and the positions reserved after it by the number of objects and children inserted at it.
+func (s *scope) shiftPlaceholders(position *placeholderPosition, objects int, children int) {
+	for _, p := range s.placeholders[slices.Index(s.placeholders, position):] {
+		p.objectIndex += objects
+		p.childIndex += children
+	}
+}
+
+// OnRenderManifests registers a function called by Builder.RenderManifests before rendering, e.g. to check that all objects were added.
+// RenderManifests panics if it returns an error.
+func (s *scope) OnRenderManifests(fn func() error) {
+	s.globalContext.renderHooks = append(s.globalContext.renderHooks, fn)
+}
+
 func (s *scope) Namespace() string {
-	return s.GetContext(namespaceContextKey).(string)
+	namespace, _ := s.GetContext(namespaceContextKey).(string)
+	return namespace
 }
 
 func (s *scope) addApiObject(obj runtime.Object) (ApiObject, error) {
@@ -115,19 +206,50 @@ func (s *scope) AddApiObject(obj runtime.Object) ApiObject {
 
 func (s *scope) AddApiObjectFromMap(obj map[string]any) ApiObject {
 	props := apiObjectProps{Unstructured: &unstructured.Unstructured{Object: obj}}
-	if props.GetNamespace() == "" {
+	namespaceDefaulted := false
+	if props.GetNamespace() == "" && !s.IsClusterScoped(props.GroupVersionKind().GroupKind()) {
 		namespaceCtx, _ := s.GetContext(namespaceContextKey).(string)
 		if namespaceCtx != "" {
 			props.SetNamespace(namespaceCtx)
+			namespaceDefaulted = true
 		}
 	}
 
-	apiObject := &apiObject{apiObjectProps: props, globalContext: s.globalContext}
+	apiObject := &apiObject{apiObjectProps: props, globalContext: s.globalContext, namespaceDefaulted: namespaceDefaulted}
 
 	s.objects = append(s.objects, apiObject)
+	if s.position != nil {
+		s.parent.objects = slices.Insert(s.parent.objects, s.position.objectIndex, ApiObject(apiObject))
+		s.parent.shiftPlaceholders(s.position, 1, 0)
+	}
+	if groupKind, ok := s.globalContext.resourceScopes.learnFromCRD(props.Unstructured); ok {
+		s.root().clearDefaultedNamespaces(groupKind)
+	}
 	return apiObject
 }
 
+func (s *scope) IsClusterScoped(groupKind schema.GroupKind) bool {
+	return s.globalContext.resourceScopes.isClusterScoped(groupKind)
+}
+
+func (s *scope) root() *scope {
+	for s.parent != nil {
+		s = s.parent
+	}
+	return s
+}
+
+// clearDefaultedNamespaces removes the namespace set from the scope on objects of the given kind, which was found to be cluster-scoped after they were added.
+func (s *scope) clearDefaultedNamespaces(groupKind schema.GroupKind) {
+	_ = s.WalkApiObjects(func(obj ApiObject) error {
+		if apiObject, ok := obj.(*apiObject); ok && apiObject.namespaceDefaulted && apiObject.GroupVersionKind().GroupKind() == groupKind {
+			apiObject.SetNamespace("")
+			apiObject.namespaceDefaulted = false
+		}
+		return nil
+	})
+}
+
 func (s *scope) WalkApiObjects(walkFn func(ApiObject) error) error {
 	for _, object := range s.objects {
 		if err := walkFn(object); err != nil {
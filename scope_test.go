@@ -0,0 +1,77 @@
+package kgen
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func addTestConfigMap(scope Scope, name string) {
+	scope.AddApiObjectFromMap(map[string]any{"apiVersion": "v1", "kind": "ConfigMap", "metadata": map[string]any{"name": name}})
+}
+
+func objectNames(scope Scope) []string {
+	names := []string{}
+	_ = scope.WalkApiObjects(func(object ApiObject) error {
+		names = append(names, object.GetName())
+		return nil
+	})
+	return names
+}
+
+func TestPlaceholder(t *testing.T) {
+	builder := NewBuilder(BuilderOptions{SchemeBuilder: runtime.SchemeBuilder{corev1.AddToScheme}})
+	app := builder.CreateScope("app", ScopeProps{Namespace: "app"})
+	addTestConfigMap(app, "a")
+	first := app.(*scope).Placeholder()
+	app.CreateScope("child", ScopeProps{})
+	second := app.(*scope).Placeholder()
+	addTestConfigMap(app, "d")
+	nested := first.(*scope).Placeholder()
+	addTestConfigMap(second, "c1")
+	addTestConfigMap(first, "b2")
+	addTestConfigMap(nested, "b1")
+	addTestConfigMap(second, "c2")
+	first.CreateScope("first-child", ScopeProps{})
+	addTestConfigMap(app, "e")
+
+	if got, want := objectNames(app), []string{"a", "b1", "b2", "c1", "c2", "d", "e"}; !slices.Equal(got, want) {
+		t.Errorf("objects = %v, want %v", got, want)
+	}
+	children := []string{}
+	for child := range app.Children() {
+		children = append(children, child.ID())
+	}
+	if want := []string{"first-child", "child"}; !slices.Equal(children, want) {
+		t.Errorf("children = %v, want %v", children, want)
+	}
+	if got := objectNames(first); !slices.Equal(got, []string{"b2"}) {
+		t.Errorf("placeholder objects = %v, want [b2]", got)
+	}
+	if first.ID() != "app" || !slices.Equal(first.Path(), []string{"app"}) || first.Namespace() != "app" {
+		t.Errorf("placeholder id = %s, path = %v, namespace = %s, want the ones of the scope", first.ID(), first.Path(), first.Namespace())
+	}
+	for child := range first.Children() {
+		if !slices.Equal(child.Path(), []string{"app", "first-child"}) {
+			t.Errorf("placeholder child path = %v, want [app first-child]", child.Path())
+		}
+	}
+}
+
+func TestOnRenderManifests(t *testing.T) {
+	builder := NewBuilder(BuilderOptions{SchemeBuilder: runtime.SchemeBuilder{corev1.AddToScheme}})
+	called := false
+	builder.CreateScope("app", ScopeProps{}).(*scope).OnRenderManifests(func() error {
+		called = true
+		return errors.New("pending objects")
+	})
+	defer func() {
+		if r := recover(); r == nil || !called {
+			t.Errorf("expected RenderManifests to call the hook and panic, got called = %v, recovered = %v", called, r)
+		}
+	}()
+	builder.RenderManifests(RenderManifestsOptions{Outdir: t.TempDir()})
+}